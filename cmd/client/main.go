@@ -2,28 +2,57 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"strings"
 	"time"
 
 	pb "try/pkg/grpcapi"
+	"try/pkg/tlsconfig"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 var services = []string{
 	"user-service",
 }
-var portToService = map[string]string{
-	"35476": "user-service-a",
-	"35188": "user-service-b",
-	"35067": "user-service-c",
-}
 
 func main() {
-	conn, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	watch := flag.Bool("watch", false, "stream backend updates for the service instead of routing requests")
+	strategy := flag.String("strategy", "", "balancing strategy to request instead of the service's configured one")
+	mode := flag.String("mode", "", "routing mode to request instead of the service's configured one: decision-only, probe or proxy")
+	addr := flag.String("addr", "localhost:50051", "address of the sidecar")
+	useTLS := flag.Bool("tls", false, "connect over TLS; implied by -ca and -cert")
+	caFile := flag.String("ca", "", "CA bundle to verify the sidecar's certificate against instead of the system roots")
+	certFile := flag.String("cert", "", "client certificate for mutual TLS, reloaded when the file changes")
+	keyFile := flag.String("key", "", "key of the client certificate")
+	serverName := flag.String("server-name", "", "name to verify the sidecar's certificate against instead of the host in -addr")
+	token := flag.String("token", "", "bearer token (static token or JWT) to authenticate with")
+	flag.Parse()
+
+	creds := insecure.NewCredentials()
+	if *useTLS || *caFile != "" || *certFile != "" {
+		files, err := tlsconfig.Load(*certFile, *keyFile, *caFile)
+		if err != nil {
+			log.Fatalf("Could not load TLS certificates: %v", err)
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		go files.Watch(30*time.Second, stop)
+		creds = credentials.NewTLS(tlsconfig.ClientConfig(files, *serverName))
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if *token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(*token)))
+	}
+	conn, err := grpc.NewClient(*addr, opts...)
 	if err != nil {
 		log.Fatalf("Could not connect: %v", err)
 	}
@@ -31,14 +60,31 @@ func main() {
 
 	client := pb.NewSidecarServiceClient(conn)
 
+	if *watch {
+		watchBackends(client, services[0])
+		return
+	}
+
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		go sendRequest(client)
+		go sendRequest(client, *strategy, *mode)
 	}
 }
 
+// bearerToken sends a token in the authorization metadata of every call.
+// It is allowed over plaintext too, for local testing.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
 // func sendRequest(client pb.SidecarServiceClient) {
 // 	service := services[rand.Intn(len(services))]
 // 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -55,28 +101,69 @@ func main() {
 
 //		fmt.Printf("Routed %s to %s\n", service, resp.Backend)
 //	}
-func sendRequest(client pb.SidecarServiceClient) {
+func sendRequest(client pb.SidecarServiceClient, strategy, mode string) {
 	service := services[rand.Intn(len(services))]
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	resp, err := client.RouteRequest(ctx, &pb.RouteRequestRequest{
 		ServiceName: service,
+		Strategy:    strategy,
+		Mode:        mode,
 	})
 
 	if err != nil {
 		log.Printf("Error routing %s: %v", service, err)
+		for i, detail := range status.Convert(err).Details() {
+			if a, ok := detail.(*pb.Attempt); ok {
+				log.Printf("  attempt %d on %s: status %d %s", i+1, a.BackendName, a.StatusCode, a.Error)
+			}
+		}
 		return
 	}
 
-	// Extract port from resp.Backend (e.g., "http://69.157.137.154:35067")
-	parts := strings.Split(resp.Backend, ":")
-	port := parts[len(parts)-1]
+	var fallbacks []string
+	for _, f := range resp.Fallbacks {
+		fallbacks = append(fallbacks, f.Name)
+	}
+	fmt.Printf("Routed %s to %s (port: %d, score: %.2f, mode: %s, status: %d, took %v, fallbacks: %s, decision: %s)\n",
+		service, resp.BackendName, resp.Port, resp.Score.GetTotal(), resp.Mode, resp.StatusCode,
+		resp.Latency.AsDuration(), strings.Join(fallbacks, ","), resp.DecisionId)
+	if len(resp.Attempts) > 1 {
+		for i, a := range resp.Attempts[:len(resp.Attempts)-1] {
+			fmt.Printf("  attempt %d on %s failed: status %d %s\n", i+1, a.BackendName, a.StatusCode, a.Error)
+		}
+	}
+	if len(resp.Body) > 0 {
+		fmt.Printf("Body: %s\n", resp.Body)
+	}
+}
 
-	serviceName, ok := portToService[port]
-	if !ok {
-		serviceName = "unknown-service"
+// watchBackends prints every backend update the sidecar pushes. An
+// application could keep the latest update and pick backends locally
+// instead of calling RouteRequest for each request.
+func watchBackends(client pb.SidecarServiceClient, service string) {
+	stream, err := client.WatchBackends(context.Background(), &pb.WatchBackendsRequest{
+		ServiceName: service,
+	})
+	if err != nil {
+		log.Fatalf("Error watching %s: %v", service, err)
 	}
 
-	fmt.Printf("Routed %s to %s (port: %s)\n", service, serviceName, port)
+	for {
+		update, err := stream.Recv()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Fatalf("Watch of %s ended: %v", service, err)
+		}
+
+		fmt.Printf("Backends of %s:\n", update.ServiceName)
+		for _, b := range update.Backends {
+			fmt.Printf("  %s %s healthy=%t ejected=%t circuit=%s score=%.2f cpu=%.2f%% mem=%.2f%% net=%.2fB/s\n",
+				b.Name, b.Url, b.Healthy, b.Ejected, b.Circuit, b.Score,
+				b.Metrics.GetCpuUsage(), b.Metrics.GetMemoryUsage(), b.Metrics.GetNetworkTraffic())
+		}
+	}
 }
@@ -1,26 +1,77 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"try/pkg/config"
 	pb "try/pkg/grpcapi"
+	"try/pkg/logging"
 	"try/pkg/server"
+	"try/pkg/tracing"
 
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
-	lis, err := net.Listen("tcp", ":50051")
+	configPath := flag.String("config", "config.yaml", "path to the sidecar config file (YAML or JSON)")
+	kubeconfig := flag.String("kubeconfig", "", "kubeconfig for EndpointSlice discovery and metrics-server; in-cluster config is used if empty")
+	reloadInterval := flag.Duration("reload-interval", 5*time.Second, "how often to check the config file for changes to reload; 0 reloads on SIGHUP only")
+	flag.Parse()
+
+	// run returns instead of exiting so that its deferred shutdown, which
+	// flushes buffered spans, happens on failure too.
+	if err := run(*configPath, *kubeconfig, *reloadInterval); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(configPath, kubeconfig string, reloadInterval time.Duration) error {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := logging.Setup(cfg.Log); err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	opts, err := server.KubernetesOptions(cfg, kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes clients: %w", err)
+	}
+	sidecar, err := server.NewSidecarServer(cfg, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create sidecar: %w", err)
+	}
+	defer sidecar.Close()
+	go sidecar.WatchConfig(configPath, reloadInterval)
+
+	lis, err := net.Listen("tcp", cfg.Listen)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		return fmt.Errorf("failed to listen: %w", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	pb.RegisterSidecarServiceServer(grpcServer, &server.SidecarServer{})
+	grpcServer := grpc.NewServer(sidecar.GRPCServerOptions()...)
+	pb.RegisterSidecarServiceServer(grpcServer, sidecar)
+	healthpb.RegisterHealthServer(grpcServer, sidecar.HealthServer())
 
-	log.Println("Sidecar gRPC server is running on port 50051")
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if err := sidecar.Serve(ctx, grpcServer, lis); err != nil {
+		return fmt.Errorf("failed to serve: %w", err)
 	}
+	return nil
 }
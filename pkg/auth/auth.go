@@ -0,0 +1,140 @@
+// Package auth authenticates the sidecar's gRPC callers with static bearer
+// tokens, JWTs or client certificates, and decides which services each
+// caller may route to.
+package auth
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"try/pkg/config"
+)
+
+// Ways a caller can authenticate.
+const (
+	MethodToken = "token"
+	MethodJWT   = "jwt"
+	MethodMTLS  = "mtls"
+)
+
+// ErrNoCredentials is returned for a caller that presented none.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Identity is an authenticated caller.
+type Identity struct {
+	Name string
+	// Method is how the caller authenticated: token, jwt or mtls.
+	Method string
+}
+
+// Authenticator checks callers' credentials and the policy.
+type Authenticator struct {
+	tokens []token
+	// keys are the JWKS keys, nil if JWT is off.
+	keys   []key
+	jwt    config.JWT
+	mtls   bool
+	policy []config.AuthRule
+}
+
+type token struct {
+	identity string
+	value    []byte
+}
+
+// New reads the token and JWKS files of cfg.
+func New(cfg config.Auth) (*Authenticator, error) {
+	a := &Authenticator{jwt: cfg.JWT, mtls: cfg.MTLS, policy: cfg.Policy}
+	for _, t := range cfg.Tokens {
+		value := t.Token
+		if t.TokenFile != "" {
+			data, err := os.ReadFile(t.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading token of %q: %w", t.Identity, err)
+			}
+			value = strings.TrimSpace(string(data))
+		}
+		if value == "" {
+			return nil, fmt.Errorf("token of %q is empty", t.Identity)
+		}
+		a.tokens = append(a.tokens, token{identity: t.Identity, value: []byte(value)})
+	}
+	if cfg.JWT.JWKSFile != "" {
+		keys, err := loadJWKS(cfg.JWT.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading JWKS: %w", err)
+		}
+		a.keys = keys
+	}
+	return a, nil
+}
+
+// Authenticate identifies a caller by its bearer token, if it sent one, or
+// else by its verified client certificate chains, if mTLS is on.
+func (a *Authenticator) Authenticate(bearer string, verifiedChains [][]*x509.Certificate) (Identity, error) {
+	if bearer != "" {
+		return a.authenticateToken(bearer)
+	}
+	if a.mtls && len(verifiedChains) > 0 && len(verifiedChains[0]) > 0 {
+		cert := verifiedChains[0][0]
+		name := cert.Subject.CommonName
+		if len(cert.URIs) > 0 {
+			name = cert.URIs[0].String()
+		}
+		if name == "" {
+			return Identity{}, errors.New("client certificate names no identity")
+		}
+		return Identity{Name: name, Method: MethodMTLS}, nil
+	}
+	return Identity{}, ErrNoCredentials
+}
+
+func (a *Authenticator) authenticateToken(bearer string) (Identity, error) {
+	// Compare against every token so that the time taken doesn't tell
+	// which one matched.
+	match := ""
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(bearer), t.value) == 1 {
+			match = t.identity
+		}
+	}
+	if match != "" {
+		return Identity{Name: match, Method: MethodToken}, nil
+	}
+	if a.keys == nil || !looksLikeJWT(bearer) {
+		return Identity{}, errors.New("invalid token")
+	}
+
+	claims, err := verifyJWT(bearer, a.keys)
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid JWT: %w", err)
+	}
+	if err := checkClaims(claims, a.jwt.Issuer, a.jwt.Audience, time.Now()); err != nil {
+		return Identity{}, fmt.Errorf("invalid JWT: %w", err)
+	}
+	name, _ := claims[a.jwt.IdentityClaim].(string)
+	if name == "" {
+		return Identity{}, fmt.Errorf("invalid JWT: no %s claim", a.jwt.IdentityClaim)
+	}
+	return Identity{Name: name, Method: MethodJWT}, nil
+}
+
+// Allowed reports whether the policy lets identity route to service.
+func (a *Authenticator) Allowed(identity, service string) bool {
+	for _, r := range a.policy {
+		if r.Identity != "*" && r.Identity != identity {
+			continue
+		}
+		for _, s := range r.Services {
+			if s == "*" || s == service {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"try/pkg/config"
+)
+
+func TestAllowed(t *testing.T) {
+	a, err := New(config.Auth{Policy: []config.AuthRule{
+		{Identity: "checkout", Services: []string{"payments", "inventory"}},
+		{Identity: "admin", Services: []string{"*"}},
+		{Identity: "*", Services: []string{"status"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		identity, service string
+		want              bool
+	}{
+		{"checkout", "payments", true},
+		{"checkout", "inventory", true},
+		{"checkout", "billing", false},
+		{"admin", "billing", true},
+		{"admin", "payments", true},
+		{"anyone", "status", true},
+		{"checkout", "status", true},
+		{"anyone", "payments", false},
+		{"", "payments", false},
+	}
+	for _, tt := range tests {
+		if got := a.Allowed(tt.identity, tt.service); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", tt.identity, tt.service, got, tt.want)
+		}
+	}
+
+	none, _ := New(config.Auth{})
+	if none.Allowed("admin", "payments") {
+		t.Error("an empty policy allowed a call")
+	}
+}
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAuthenticate(t *testing.T) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "alg": "RS256", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		{"kty": "oct", "kid": "hmac"},
+	}})
+	a, err := New(config.Auth{
+		Tokens: []config.AuthToken{
+			{Identity: "inline", Token: "inline-token"},
+			{Identity: "file", TokenFile: writeFile(t, "token", []byte("file-token\n"))},
+		},
+		JWT: config.JWT{
+			JWKSFile:      writeFile(t, "jwks.json", jwks),
+			Issuer:        "issuer",
+			Audience:      "sidecar",
+			IdentityClaim: "sub",
+		},
+		MTLS: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.keys) != 1 {
+		t.Fatalf("loaded %d keys, want only the RSA signing key", len(a.keys))
+	}
+
+	jwt := func(claims map[string]any) string {
+		return sign(t, map[string]any{"alg": "RS256", "kid": "rsa"}, claims, rsaKey)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	spiffe, _ := url.Parse("spiffe://cluster/ns/shop/sa/cart")
+	chains := func(cert *x509.Certificate) [][]*x509.Certificate { return [][]*x509.Certificate{{cert}} }
+
+	tests := []struct {
+		name    string
+		bearer  string
+		chains  [][]*x509.Certificate
+		want    Identity
+		wantErr string
+	}{
+		{name: "inline token", bearer: "inline-token", want: Identity{"inline", MethodToken}},
+		{name: "token file", bearer: "file-token", want: Identity{"file", MethodToken}},
+		{name: "unknown token", bearer: "guess", wantErr: "invalid token"},
+		{
+			name:   "JWT",
+			bearer: jwt(map[string]any{"sub": "checkout", "iss": "issuer", "aud": "sidecar", "exp": exp}),
+			want:   Identity{"checkout", MethodJWT},
+		},
+		{
+			name:    "JWT of another issuer",
+			bearer:  jwt(map[string]any{"sub": "checkout", "iss": "evil", "aud": "sidecar", "exp": exp}),
+			wantErr: "issuer",
+		},
+		{
+			name:    "JWT for another audience",
+			bearer:  jwt(map[string]any{"sub": "checkout", "iss": "issuer", "aud": "other", "exp": exp}),
+			wantErr: "audience",
+		},
+		{
+			name:    "expired JWT",
+			bearer:  jwt(map[string]any{"sub": "checkout", "iss": "issuer", "aud": "sidecar", "exp": time.Now().Add(-time.Hour).Unix()}),
+			wantErr: "expired",
+		},
+		{
+			name:    "JWT without identity",
+			bearer:  jwt(map[string]any{"iss": "issuer", "aud": "sidecar", "exp": exp}),
+			wantErr: "no sub claim",
+		},
+		{
+			name:    "unsigned JWT",
+			bearer:  sign(t, map[string]any{"alg": "none"}, map[string]any{"sub": "admin", "iss": "issuer", "aud": "sidecar", "exp": exp}, nil),
+			wantErr: "no key verifies",
+		},
+		{
+			name:   "client certificate URI",
+			chains: chains(&x509.Certificate{Subject: pkix.Name{CommonName: "cart"}, URIs: []*url.URL{spiffe}}),
+			want:   Identity{"spiffe://cluster/ns/shop/sa/cart", MethodMTLS},
+		},
+		{
+			name:   "client certificate common name",
+			chains: chains(&x509.Certificate{Subject: pkix.Name{CommonName: "cart"}}),
+			want:   Identity{"cart", MethodMTLS},
+		},
+		{
+			name:    "client certificate without a name",
+			chains:  chains(&x509.Certificate{}),
+			wantErr: "no identity",
+		},
+		{name: "nothing", wantErr: ErrNoCredentials.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Authenticate(tt.bearer, tt.chains)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("identity = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	noMTLS, _ := New(config.Auth{Tokens: []config.AuthToken{{Identity: "inline", Token: "inline-token"}}})
+	if _, err := noMTLS.Authenticate("", chains(&x509.Certificate{Subject: pkix.Name{CommonName: "cart"}})); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("without mtls, a client certificate gave err = %v, want %v", err, ErrNoCredentials)
+	}
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	rsaKey, _   = rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _    = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ = ed25519.GenerateKey(rand.Reader)
+)
+
+func testKeys() []key {
+	return []key{
+		{kid: "rsa", alg: "RS256", pub: &rsaKey.PublicKey},
+		{kid: "ec", pub: &ecKey.PublicKey},
+		{kid: "ed", alg: "EdDSA", pub: edKey.Public()},
+	}
+}
+
+func segment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign returns a compact JWS of claims with the given header, signed with
+// priv by the header's alg. For none the signature is empty, and for HS256
+// the secret is fixed.
+func sign(t *testing.T, header map[string]any, claims map[string]any, priv crypto.Signer) string {
+	t.Helper()
+	signed := segment(t, header) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	var err error
+	switch alg := header["alg"]; alg {
+	case "none":
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, priv.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case "PS256":
+		sig, err = rsa.SignPSS(rand.Reader, priv.(*rsa.PrivateKey), crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256":
+		r, s, e := ecdsa.Sign(rand.Reader, priv.(*ecdsa.PrivateKey), digest[:])
+		sig, err = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), e
+	case "EdDSA":
+		sig = ed25519.Sign(priv.(ed25519.PrivateKey), []byte(signed))
+	default:
+		t.Fatalf("cannot sign %v", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifyJWT(t *testing.T) {
+	claims := map[string]any{"sub": "checkout", "exp": time.Now().Add(time.Hour).Unix()}
+	tests := []struct {
+		name    string
+		header  map[string]any
+		priv    crypto.Signer
+		wantErr string
+	}{
+		{name: "RS256", header: map[string]any{"alg": "RS256", "kid": "rsa"}, priv: rsaKey},
+		{name: "ES256", header: map[string]any{"alg": "ES256", "kid": "ec"}, priv: ecKey},
+		{name: "EdDSA", header: map[string]any{"alg": "EdDSA", "kid": "ed"}, priv: edKey},
+		{name: "no kid tries every key", header: map[string]any{"alg": "ES256"}, priv: ecKey},
+		{
+			name:    "alg none",
+			header:  map[string]any{"alg": "none"},
+			wantErr: "no key verifies the none signature",
+		},
+		{
+			name:    "HS256",
+			header:  map[string]any{"alg": "HS256"},
+			wantErr: "no key verifies the HS256 signature",
+		},
+		{
+			name:    "alg other than the key's",
+			header:  map[string]any{"alg": "PS256", "kid": "rsa"},
+			priv:    rsaKey,
+			wantErr: "no key verifies",
+		},
+		{
+			name:    "kid of another key",
+			header:  map[string]any{"alg": "ES256", "kid": "rsa"},
+			priv:    ecKey,
+			wantErr: "no key verifies",
+		},
+		{
+			name:    "unknown kid",
+			header:  map[string]any{"alg": "RS256", "kid": "old"},
+			priv:    rsaKey,
+			wantErr: "no key verifies",
+		},
+		{
+			name:    "signed by a key not in the set",
+			header:  map[string]any{"alg": "EdDSA"},
+			priv:    func() ed25519.PrivateKey { _, k, _ := ed25519.GenerateKey(rand.Reader); return k }(),
+			wantErr: "no key verifies",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyJWT(sign(t, tt.header, claims, tt.priv), testKeys())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got["sub"] != "checkout" {
+				t.Errorf("sub = %v, want checkout", got["sub"])
+			}
+		})
+	}
+}
+
+func TestVerifyJWTTampered(t *testing.T) {
+	token := sign(t, map[string]any{"alg": "RS256"}, map[string]any{"sub": "checkout"}, rsaKey)
+	parts := strings.Split(token, ".")
+	parts[1] = segment(t, map[string]any{"sub": "admin"})
+	if _, err := verifyJWT(strings.Join(parts, "."), testKeys()); err == nil {
+		t.Fatal("accepted a token with altered claims")
+	}
+	if _, err := verifyJWT("a.b", testKeys()); err == nil {
+		t.Fatal("accepted a malformed token")
+	}
+}
+
+func TestVerifySignatureKeyType(t *testing.T) {
+	signed := []byte("header.claims")
+	digest := sha256.Sum256(signed)
+	rsaSig, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	tests := []struct {
+		alg string
+		pub crypto.PublicKey
+	}{
+		{"RS256", &ecKey.PublicKey},
+		{"PS256", edKey.Public()},
+		{"ES256", &rsaKey.PublicKey},
+		{"EdDSA", &rsaKey.PublicKey},
+	}
+	for _, tt := range tests {
+		if err := verifySignature(tt.alg, tt.pub, signed, rsaSig); err == nil {
+			t.Errorf("%s verified with a %T", tt.alg, tt.pub)
+		}
+	}
+	for _, alg := range []string{"none", "HS256", "RS1", "ES999", ""} {
+		if err := verifySignature(alg, &rsaKey.PublicKey, signed, rsaSig); err == nil {
+			t.Errorf("%q verified", alg)
+		}
+	}
+	if err := verifySignature("RS256", &rsaKey.PublicKey, signed, rsaSig); err != nil {
+		t.Errorf("RS256: %v", err)
+	}
+}
+
+func TestCheckClaims(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	at := func(d time.Duration) json.Number {
+		return json.Number(strconv.FormatInt(now.Add(d).Unix(), 10))
+	}
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		wantErr string
+	}{
+		{name: "valid", claims: map[string]any{"exp": at(time.Hour), "iss": "issuer", "aud": "sidecar"}},
+		{name: "audience list", claims: map[string]any{"exp": at(time.Hour), "iss": "issuer", "aud": []any{"other", "sidecar"}}},
+		{name: "expired within the skew", claims: map[string]any{"exp": at(-30 * time.Second), "iss": "issuer", "aud": "sidecar"}},
+		{name: "nbf within the skew", claims: map[string]any{"exp": at(time.Hour), "nbf": at(30 * time.Second), "iss": "issuer", "aud": "sidecar"}},
+		{name: "no exp", claims: map[string]any{"iss": "issuer", "aud": "sidecar"}, wantErr: "no exp"},
+		{name: "exp not a number", claims: map[string]any{"exp": "tomorrow", "iss": "issuer", "aud": "sidecar"}, wantErr: "no exp"},
+		{name: "expired", claims: map[string]any{"exp": at(-2 * time.Minute), "iss": "issuer", "aud": "sidecar"}, wantErr: "expired"},
+		{name: "nbf in the future", claims: map[string]any{"exp": at(time.Hour), "nbf": at(2 * time.Minute), "iss": "issuer", "aud": "sidecar"}, wantErr: "not valid yet"},
+		{name: "wrong issuer", claims: map[string]any{"exp": at(time.Hour), "iss": "evil", "aud": "sidecar"}, wantErr: "issuer"},
+		{name: "no issuer", claims: map[string]any{"exp": at(time.Hour), "aud": "sidecar"}, wantErr: "issuer"},
+		{name: "wrong audience", claims: map[string]any{"exp": at(time.Hour), "iss": "issuer", "aud": "other"}, wantErr: "audience"},
+		{name: "audience list without ours", claims: map[string]any{"exp": at(time.Hour), "iss": "issuer", "aud": []any{"a", "b"}}, wantErr: "audience"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkClaims(tt.claims, "issuer", "sidecar", now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package balancer
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+const (
+	MetricScore        = "metric-score"
+	RoundRobin         = "round-robin"
+	WeightedRoundRobin = "weighted-round-robin"
+	LeastOutstanding   = "least-outstanding"
+	PowerOfTwo         = "power-of-two"
+	Random             = "random"
+)
+
+// Candidate is a backend a Balancer can pick.
+type Candidate struct {
+	Name   string
+	Weight int
+	// Score is the backend's combined load score, lower is better.
+	Score float64
+	// Outstanding is the number of requests in flight to the backend.
+	Outstanding int
+}
+
+// Balancer picks one of a service's backends. Pick is called with at least
+// one candidate, in a stable order (by name), and returns the index of the
+// chosen one. Implementations are safe for concurrent use.
+type Balancer interface {
+	Pick(candidates []Candidate) int
+}
+
+// Known reports whether strategy names a balancer; empty means the default.
+func Known(strategy string) bool {
+	switch strategy {
+	case "", MetricScore, RoundRobin, WeightedRoundRobin, LeastOutstanding, PowerOfTwo, Random:
+		return true
+	}
+	return false
+}
+
+// New returns the balancer for a strategy name. src seeds the strategies
+// that pick randomly, so that tests can make them deterministic.
+func New(strategy string, src rand.Source) (Balancer, error) {
+	switch strategy {
+	case MetricScore, "":
+		return metricScore{}, nil
+	case RoundRobin:
+		return &roundRobin{}, nil
+	case WeightedRoundRobin:
+		return &weightedRoundRobin{current: map[string]int{}}, nil
+	case LeastOutstanding:
+		return leastOutstanding{}, nil
+	case PowerOfTwo:
+		return &powerOfTwo{rand: rand.New(src)}, nil
+	case Random:
+		return &random{rand: rand.New(src)}, nil
+	}
+	return nil, fmt.Errorf("unknown balancing strategy %q", strategy)
+}
+
+// metricScore picks the lowest score, the sidecar's original behavior.
+type metricScore struct{}
+
+func (metricScore) Pick(candidates []Candidate) int {
+	best := 0
+	for i := range candidates[1:] {
+		if candidates[i+1].Score < candidates[best].Score {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+type roundRobin struct {
+	mu   sync.Mutex
+	next int
+}
+
+func (r *roundRobin) Pick(candidates []Candidate) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.next % len(candidates)
+	r.next = i + 1
+	return i
+}
+
+// weightedRoundRobin is nginx's smooth weighted round-robin: every pick adds
+// each backend's weight to its current weight, picks the highest and
+// subtracts the total from it. Picks are spread out rather than bunched.
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[string]int
+}
+
+func (w *weightedRoundRobin) Pick(candidates []Candidate) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Forget backends that are gone so they start fresh if they return.
+	present := map[string]bool{}
+	for _, c := range candidates {
+		present[c.Name] = true
+	}
+	for name := range w.current {
+		if !present[name] {
+			delete(w.current, name)
+		}
+	}
+
+	best, total := -1, 0
+	for i, c := range candidates {
+		w.current[c.Name] += c.Weight
+		total += c.Weight
+		if best < 0 || w.current[c.Name] > w.current[candidates[best].Name] {
+			best = i
+		}
+	}
+	w.current[candidates[best].Name] -= total
+	return best
+}
+
+// leastOutstanding picks the backend with the fewest requests in flight
+// relative to its weight, breaking ties by score.
+type leastOutstanding struct{}
+
+func (leastOutstanding) Pick(candidates []Candidate) int {
+	load := func(c Candidate) float64 { return float64(c.Outstanding) / float64(c.Weight) }
+	best := 0
+	for i, c := range candidates[1:] {
+		b := candidates[best]
+		if load(c) < load(b) || (load(c) == load(b) && c.Score < b.Score) {
+			best = i + 1
+		}
+	}
+	return best
+}
+
+// powerOfTwo samples two different backends at random and picks the one
+// with the lower score, which avoids every sidecar herding onto the single
+// least loaded backend between metric refreshes.
+type powerOfTwo struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (p *powerOfTwo) Pick(candidates []Candidate) int {
+	if len(candidates) == 1 {
+		return 0
+	}
+	p.mu.Lock()
+	a := p.rand.Intn(len(candidates))
+	b := p.rand.Intn(len(candidates) - 1)
+	p.mu.Unlock()
+	if b >= a {
+		b++
+	}
+	if candidates[b].Score < candidates[a].Score {
+		return b
+	}
+	return a
+}
+
+type random struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *random) Pick(candidates []Candidate) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rand.Intn(len(candidates))
+}
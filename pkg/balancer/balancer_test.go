@@ -0,0 +1,205 @@
+package balancer
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func picks(t *testing.T, b Balancer, candidates []Candidate, n int) []int {
+	t.Helper()
+	got := make([]int, n)
+	for i := range got {
+		got[i] = b.Pick(candidates)
+		if got[i] < 0 || got[i] >= len(candidates) {
+			t.Fatalf("pick %d: index %d out of range", i, got[i])
+		}
+	}
+	return got
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNew(t *testing.T) {
+	for _, strategy := range []string{"", MetricScore, RoundRobin, WeightedRoundRobin, LeastOutstanding, PowerOfTwo, Random} {
+		if !Known(strategy) {
+			t.Errorf("Known(%q) = false", strategy)
+		}
+		if _, err := New(strategy, rand.NewSource(1)); err != nil {
+			t.Errorf("New(%q): %v", strategy, err)
+		}
+	}
+	if Known("fastest") {
+		t.Error(`Known("fastest") = true`)
+	}
+	if _, err := New("fastest", rand.NewSource(1)); err == nil {
+		t.Error(`New("fastest") succeeded`)
+	}
+}
+
+func TestPick(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   string
+		candidates []Candidate
+		want       []int
+	}{
+		{
+			name:     "metric score picks the lowest score",
+			strategy: MetricScore,
+			candidates: []Candidate{
+				{Name: "a", Weight: 1, Score: 0.5},
+				{Name: "b", Weight: 1, Score: 0.2},
+				{Name: "c", Weight: 1, Score: 0.9},
+			},
+			want: []int{1, 1, 1},
+		},
+		{
+			name:     "metric score keeps the first of equal scores",
+			strategy: MetricScore,
+			candidates: []Candidate{
+				{Name: "a", Weight: 1, Score: 0.3},
+				{Name: "b", Weight: 1, Score: 0.3},
+			},
+			want: []int{0, 0},
+		},
+		{
+			name:     "round robin cycles",
+			strategy: RoundRobin,
+			candidates: []Candidate{
+				{Name: "a", Weight: 1},
+				{Name: "b", Weight: 1},
+				{Name: "c", Weight: 1},
+			},
+			want: []int{0, 1, 2, 0, 1, 2, 0},
+		},
+		{
+			name:     "smooth weighted round robin spreads picks",
+			strategy: WeightedRoundRobin,
+			candidates: []Candidate{
+				{Name: "a", Weight: 5},
+				{Name: "b", Weight: 1},
+				{Name: "c", Weight: 1},
+			},
+			want: []int{0, 0, 1, 0, 2, 0, 0, 0, 0, 1, 0, 2, 0, 0},
+		},
+		{
+			name:     "least outstanding relative to weight",
+			strategy: LeastOutstanding,
+			candidates: []Candidate{
+				{Name: "a", Weight: 1, Outstanding: 2, Score: 0.1},
+				{Name: "b", Weight: 4, Outstanding: 4, Score: 0.9},
+				{Name: "c", Weight: 1, Outstanding: 3, Score: 0.1},
+			},
+			want: []int{1, 1},
+		},
+		{
+			name:     "least outstanding breaks ties by score",
+			strategy: LeastOutstanding,
+			candidates: []Candidate{
+				{Name: "a", Weight: 1, Outstanding: 1, Score: 0.7},
+				{Name: "b", Weight: 2, Outstanding: 2, Score: 0.2},
+				{Name: "c", Weight: 1, Outstanding: 1, Score: 0.4},
+			},
+			want: []int{1, 1},
+		},
+		{
+			name:       "power of two with a single backend",
+			strategy:   PowerOfTwo,
+			candidates: []Candidate{{Name: "a", Weight: 1}},
+			want:       []int{0, 0},
+		},
+		{
+			name:       "random with a single backend",
+			strategy:   Random,
+			candidates: []Candidate{{Name: "a", Weight: 1}},
+			want:       []int{0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(tt.strategy, rand.NewSource(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := picks(t, b, tt.candidates, len(tt.want)); !equal(got, tt.want) {
+				t.Errorf("picks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomizedStrategies(t *testing.T) {
+	candidates := []Candidate{
+		{Name: "a", Weight: 1, Score: 0.2},
+		{Name: "b", Weight: 1, Score: 0.5},
+		{Name: "c", Weight: 1, Score: 0.9},
+	}
+	for _, strategy := range []string{PowerOfTwo, Random} {
+		t.Run(strategy, func(t *testing.T) {
+			b1, _ := New(strategy, rand.NewSource(1))
+			b2, _ := New(strategy, rand.NewSource(1))
+			got := picks(t, b1, candidates, 200)
+			if again := picks(t, b2, candidates, 200); !equal(got, again) {
+				t.Fatal("the same seed gave different picks")
+			}
+
+			counts := make([]int, len(candidates))
+			for _, i := range got {
+				counts[i]++
+			}
+			switch strategy {
+			case PowerOfTwo:
+				// The worst backend loses every comparison; the best wins
+				// every one it is sampled for, two thirds of them.
+				if counts[2] != 0 {
+					t.Errorf("picked the highest score %d times", counts[2])
+				}
+				if counts[0] <= counts[1] {
+					t.Errorf("counts = %v, want the lowest score picked most", counts)
+				}
+			case Random:
+				for i, n := range counts {
+					if n == 0 {
+						t.Errorf("never picked %s", candidates[i].Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinForgetsRemovedBackends(t *testing.T) {
+	b, _ := New(WeightedRoundRobin, rand.NewSource(1))
+	wrr := b.(*weightedRoundRobin)
+	all := []Candidate{
+		{Name: "a", Weight: 5},
+		{Name: "b", Weight: 1},
+		{Name: "c", Weight: 1},
+	}
+	// After a, a, b, c has built up a current weight of 3.
+	picks(t, b, all, 3)
+	if got := wrr.current["c"]; got != 3 {
+		t.Fatalf("c's current weight = %d, want 3", got)
+	}
+
+	picks(t, b, all[:2], 1)
+	if _, ok := wrr.current["c"]; ok {
+		t.Fatal("c's current weight was kept after it was removed")
+	}
+
+	// Back again, c starts from zero like a new backend.
+	picks(t, b, all, 1)
+	if got := wrr.current["c"]; got != 1 {
+		t.Errorf("c's current weight = %d, want 1", got)
+	}
+}
@@ -0,0 +1,251 @@
+package circuit
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"try/pkg/config"
+)
+
+type State int
+
+const (
+	// Closed lets every request through.
+	Closed State = iota
+	// Open rejects every request until OpenDuration is over.
+	Open
+	// HalfOpen lets a few trial requests through to see if the backend has
+	// recovered.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Trial identifies the half-open period a request was sent in, so that Done
+// only counts down the trials of the current one. The zero Trial is a
+// request sent while the circuit was closed.
+type Trial uint64
+
+// Status is the circuit of one backend.
+type Status struct {
+	State string    `json:"state"`
+	Since time.Time `json:"since"`
+	// Opened counts the times the circuit has opened.
+	Opened int `json:"opened"`
+}
+
+type breaker struct {
+	state  State
+	since  time.Time
+	opened int
+
+	consecutive        int
+	windowStart        time.Time
+	requests, failures int
+
+	// period is the current half-open period, trials the requests sent in
+	// it that are still in flight and successes the ones that succeeded.
+	period            Trial
+	trials, successes int
+}
+
+// Breakers holds a circuit breaker for each backend of one service.
+type Breakers struct {
+	service string
+	cfg     config.CircuitBreaker
+	// OnChange, if set, is called after a circuit changes state.
+	OnChange func()
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+	// periods numbers the half-open periods of all backends.
+	periods Trial
+}
+
+func NewBreakers(service string, cfg config.CircuitBreaker) *Breakers {
+	return &Breakers{service: service, cfg: cfg, breakers: map[string]*breaker{}}
+}
+
+func (b *Breakers) get(name string, now time.Time) *breaker {
+	br, ok := b.breakers[name]
+	if !ok {
+		br = &breaker{since: now, windowStart: now}
+		b.breakers[name] = br
+	}
+	return br
+}
+
+// state returns the circuit's state, taking an open circuit whose
+// OpenDuration is over as half-open. b.mu must be held.
+func (b *Breakers) state(br *breaker, now time.Time) State {
+	if br.state == Open && now.Sub(br.since) >= b.cfg.OpenDuration {
+		return HalfOpen
+	}
+	return br.state
+}
+
+// Allow reports whether a request may be sent to a backend: always if its
+// circuit is closed, never if it is open, and if fewer than
+// HalfOpenRequests trials are in flight if it is half-open.
+func (b *Breakers) Allow(name string) bool {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.breakers[name]
+	if !ok {
+		return true
+	}
+	switch b.state(br, now) {
+	case Open:
+		return false
+	case HalfOpen:
+		return br.trials < b.cfg.HalfOpenRequests
+	}
+	return true
+}
+
+// Acquire counts a request sent to a half-open backend as a trial until
+// Done is called with the Trial it returns. It may be called with the
+// service's lock held, so it never calls OnChange synchronously.
+func (b *Breakers) Acquire(name string) Trial {
+	now := time.Now()
+	b.mu.Lock()
+	br := b.get(name, now)
+	changed := false
+	if br.state == Open && b.state(br, now) == HalfOpen {
+		b.transition(name, br, HalfOpen, now)
+		changed = true
+	}
+	var trial Trial
+	if br.state == HalfOpen {
+		br.trials++
+		trial = br.period
+	}
+	b.mu.Unlock()
+
+	if changed && b.OnChange != nil {
+		go b.OnChange()
+	}
+	return trial
+}
+
+// Done ends a request counted by Acquire. Trials of an earlier half-open
+// period no longer count and are ignored.
+func (b *Breakers) Done(name string, trial Trial) {
+	if trial == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if br, ok := b.breakers[name]; ok && br.state == HalfOpen && br.period == trial && br.trials > 0 {
+		br.trials--
+	}
+}
+
+// Record adds the outcome of a request to a backend's circuit.
+func (b *Breakers) Record(name string, failed bool) {
+	now := time.Now()
+	b.mu.Lock()
+	br := b.get(name, now)
+	changed := false
+	switch br.state {
+	case Closed:
+		if now.Sub(br.windowStart) >= b.cfg.Window {
+			br.windowStart = now
+			br.requests, br.failures = 0, 0
+		}
+		br.requests++
+		if failed {
+			br.failures++
+			br.consecutive++
+		} else {
+			br.consecutive = 0
+		}
+		if br.consecutive >= b.cfg.ConsecutiveFailures ||
+			(br.requests >= b.cfg.MinRequests && br.failures*100 >= br.requests*b.cfg.FailureRatePercent) {
+			b.transition(name, br, Open, now)
+			changed = true
+		}
+	case HalfOpen:
+		if failed {
+			b.transition(name, br, Open, now)
+			changed = true
+			break
+		}
+		br.successes++
+		if br.successes >= b.cfg.HalfOpenRequests {
+			b.transition(name, br, Closed, now)
+			changed = true
+		}
+	}
+	// Results that arrive while the circuit is open were sent before it
+	// opened and are ignored.
+	b.mu.Unlock()
+
+	if changed && b.OnChange != nil {
+		b.OnChange()
+	}
+}
+
+// transition moves a circuit to a new state and resets its counters. b.mu
+// must be held.
+func (b *Breakers) transition(name string, br *breaker, to State, now time.Time) {
+	level := slog.LevelInfo
+	if to == Open {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, "circuit changed state", "service", b.service, "backend", name,
+		"state", to.String(), "previous", br.state.String())
+	if to == Open {
+		br.opened++
+	}
+	br.state = to
+	br.since = now
+	br.consecutive = 0
+	br.windowStart = now
+	br.requests, br.failures = 0, 0
+	br.trials, br.successes = 0, 0
+	br.period = 0
+	if to == HalfOpen {
+		b.periods++
+		br.period = b.periods
+	}
+}
+
+// Status returns the circuit of a backend.
+func (b *Breakers) Status(name string) Status {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.breakers[name]
+	if !ok {
+		return Status{State: Closed.String()}
+	}
+	return Status{State: b.state(br, now).String(), Since: br.since, Opened: br.opened}
+}
+
+// Retain forgets the circuits of backends not in names.
+func (b *Breakers) Retain(names []string) {
+	keep := map[string]bool{}
+	for _, name := range names {
+		keep[name] = true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for name := range b.breakers {
+		if !keep[name] {
+			delete(b.breakers, name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package circuit
+
+import (
+	"testing"
+	"time"
+
+	"try/pkg/config"
+)
+
+func newTestBreakers() *Breakers {
+	return NewBreakers("cart", config.CircuitBreaker{
+		ConsecutiveFailures: 1,
+		FailureRatePercent:  100,
+		MinRequests:         100,
+		Window:              time.Minute,
+		OpenDuration:        time.Hour,
+		HalfOpenRequests:    2,
+	})
+}
+
+// expire ends the OpenDuration of a backend's open circuit.
+func expire(b *Breakers, name string) {
+	b.mu.Lock()
+	b.breakers[name].since = time.Now().Add(-2 * time.Hour)
+	b.mu.Unlock()
+}
+
+func TestHalfOpenTrials(t *testing.T) {
+	b := newTestBreakers()
+
+	// Requests in flight while closed are not trials.
+	for i := 0; i < 3; i++ {
+		if trial := b.Acquire("cart-1"); trial != 0 {
+			t.Fatalf("request sent while closed is trial %d", trial)
+		}
+	}
+	b.Record("cart-1", true)
+	if b.Allow("cart-1") {
+		t.Fatal("open circuit allowed a request")
+	}
+	expire(b, "cart-1")
+	if !b.Allow("cart-1") {
+		t.Fatal("requests sent while closed use up the half-open trials")
+	}
+
+	first := b.Acquire("cart-1")
+	if got := b.Status("cart-1").State; got != "half-open" {
+		t.Fatalf("state = %s, want half-open", got)
+	}
+	if first == 0 {
+		t.Fatal("request sent while half-open is not a trial")
+	}
+	if !b.Allow("cart-1") {
+		t.Fatal("half-open circuit refused its second trial")
+	}
+	second := b.Acquire("cart-1")
+	if b.Allow("cart-1") {
+		t.Fatal("half-open circuit allowed more than HalfOpenRequests trials")
+	}
+	b.Done("cart-1", second)
+	if !b.Allow("cart-1") {
+		t.Fatal("finished trial still counted")
+	}
+	b.Done("cart-1", first)
+}
+
+func TestStaleTrial(t *testing.T) {
+	b := newTestBreakers()
+	b.Record("cart-1", true)
+	expire(b, "cart-1")
+
+	// A trial is still in flight when another one fails and reopens the
+	// circuit.
+	stale := b.Acquire("cart-1")
+	b.Acquire("cart-1")
+	b.Record("cart-1", true)
+	if got := b.Status("cart-1"); got.State != "open" || got.Opened != 2 {
+		t.Fatalf("status = %+v, want opened a second time", got)
+	}
+
+	// It ends during the next half-open period, which already has all of
+	// its trials in flight.
+	expire(b, "cart-1")
+	current := b.Acquire("cart-1")
+	b.Acquire("cart-1")
+	if current == stale {
+		t.Fatal("two half-open periods share a trial number")
+	}
+	b.Done("cart-1", stale)
+	if b.Allow("cart-1") {
+		t.Fatal("a trial of the previous half-open period freed a trial of this one")
+	}
+	b.Done("cart-1", current)
+	if !b.Allow("cart-1") {
+		t.Fatal("finished trial still counted")
+	}
+}
+
+func TestHalfOpenCloses(t *testing.T) {
+	b := newTestBreakers()
+	b.Record("cart-1", true)
+	expire(b, "cart-1")
+	for i := 0; i < 2; i++ {
+		trial := b.Acquire("cart-1")
+		b.Record("cart-1", false)
+		b.Done("cart-1", trial)
+	}
+	if got := b.Status("cart-1").State; got != "closed" {
+		t.Fatalf("state = %s after HalfOpenRequests successes, want closed", got)
+	}
+}
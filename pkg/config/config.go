@@ -0,0 +1,820 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"try/pkg/balancer"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the sidecar configuration file. YAML is the native format; since
+// YAML is a superset of JSON, a .json file with the same keys works as well.
+type Config struct {
+	Listen      string `yaml:"listen"`
+	GraphListen string `yaml:"graph_listen"`
+	// MetricsListen serves the sidecar's own Prometheus metrics on
+	// /metrics.
+	MetricsListen string `yaml:"metrics_listen"`
+	PrometheusURL string `yaml:"prometheus_url"`
+	MaxHistory    int    `yaml:"max_history"`
+	// MetricsInterval is how often backend metrics are refreshed in the
+	// background; routing only ever reads the last refresh.
+	MetricsInterval time.Duration `yaml:"metrics_interval"`
+	Services        []Service     `yaml:"services"`
+	HTTPProxy       HTTPProxy     `yaml:"http_proxy"`
+	GRPCProxy       GRPCProxy     `yaml:"grpc_proxy"`
+	Log             Log           `yaml:"log"`
+	Tracing         Tracing       `yaml:"tracing"`
+	Admin           Admin         `yaml:"admin"`
+	Shutdown        Shutdown      `yaml:"shutdown"`
+	Readiness       Readiness     `yaml:"readiness"`
+	TLS             TLS           `yaml:"tls"`
+	Auth            Auth          `yaml:"auth"`
+}
+
+// Auth authenticates the callers of the gRPC listener and limits the
+// services each may route to. It is off unless at least one of static
+// tokens, JWT or mTLS is configured. The health service stays open.
+type Auth struct {
+	// Tokens are static bearer tokens, each standing for an identity.
+	Tokens []AuthToken `yaml:"tokens"`
+	JWT    JWT         `yaml:"jwt"`
+	// MTLS authenticates callers without a bearer token by their verified
+	// client certificate: the identity is its first URI SAN, such as a
+	// SPIFFE ID, or else its subject common name.
+	MTLS bool `yaml:"mtls"`
+	// Policy lists the services each identity may route to. Callers no
+	// rule allows are denied.
+	Policy []AuthRule `yaml:"policy"`
+}
+
+// AuthToken is a bearer token, given inline or in TokenFile.
+type AuthToken struct {
+	Identity  string `yaml:"identity"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+// JWT verifies bearer tokens that are JSON Web Tokens signed with a key of
+// the JWKS in JWKSFile. It is off unless JWKSFile is set.
+type JWT struct {
+	JWKSFile string `yaml:"jwks_file"`
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// IdentityClaim is the claim holding the caller's identity. Defaults to
+	// sub.
+	IdentityClaim string `yaml:"identity_claim"`
+}
+
+// AuthRule lets Identity route to Services. "*" matches any authenticated
+// caller or any service.
+type AuthRule struct {
+	Identity string   `yaml:"identity"`
+	Services []string `yaml:"services"`
+}
+
+// Enabled reports whether callers must authenticate.
+func (a Auth) Enabled() bool {
+	return len(a.Tokens) > 0 || a.JWT.JWKSFile != "" || a.MTLS
+}
+
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// TLS serves the gRPC listener over TLS. It is off unless CertFile and
+// KeyFile are set. The files are reread every ReloadInterval, so rotated
+// certificates are picked up without a restart.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile is the CA bundle client certificates are verified
+	// against.
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is none, optional (verify a certificate if the client
+	// sends one) or require. Defaults to require if ClientCAFile is set and
+	// none otherwise.
+	ClientAuth string `yaml:"client_auth"`
+	// ReloadInterval defaults to 30s.
+	ReloadInterval time.Duration `yaml:"reload_interval"`
+}
+
+// Enabled reports whether the gRPC listener uses TLS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Readiness decides when a service reports NOT_SERVING on the gRPC health
+// service and /readyz. A service is also not serving while none of its
+// backends can be routed to.
+type Readiness struct {
+	// MaxMetricsFailures is the number of metrics refreshes in a row that may
+	// fail before the service is not serving. Defaults to 3.
+	MaxMetricsFailures int `yaml:"max_metrics_failures"`
+}
+
+// Shutdown is how the sidecar stops on SIGTERM or SIGINT: readiness fails at
+// once, the listeners close after Delay, and requests in flight then get up
+// to Timeout to finish before they are cut off.
+type Shutdown struct {
+	// Delay gives Kubernetes and load balancers time to notice the failing
+	// readiness and stop sending new requests. Defaults to 0.
+	Delay time.Duration `yaml:"delay"`
+	// Timeout defaults to 25s, which with no Delay fits in the Kubernetes
+	// default termination grace period of 30s.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Admin is the HTTP API operators use to drain, disable and re-weight
+// backends at runtime. It is off unless Listen is set, and every request
+// must carry the bearer token.
+type Admin struct {
+	Listen string `yaml:"listen"`
+	// Token is the bearer token, or TokenFile a file holding it.
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+// Tracing exports OpenTelemetry spans over OTLP/gRPC. Trace context is
+// propagated with W3C traceparent headers either way; spans are only
+// recorded and exported if Enabled.
+type Tracing struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host:port of the OTLP/gRPC collector.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure connects to the collector without TLS.
+	Insecure bool `yaml:"insecure"`
+	// ServiceName is the service.name resource attribute of every span.
+	ServiceName string `yaml:"service_name"`
+	// SampleRatio is the share of new traces recorded, from 0 to 1. Traces
+	// started upstream follow the caller's sampling decision.
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Log configures the sidecar's structured logs, written to stderr.
+type Log struct {
+	// Format is text (default) or json.
+	Format string `yaml:"format"`
+	// Level is debug, info (default), warn or error.
+	Level string `yaml:"level"`
+	// DecisionSampleRate is the share of successful routing decisions that
+	// are logged, from 0 to 1. Defaults to 1; failed decisions are always
+	// logged.
+	DecisionSampleRate float64 `yaml:"decision_sample_rate"`
+}
+
+// GRPCProxy makes the gRPC listener forward calls to any service other than
+// SidecarService to a backend of the service they are routed to: the one
+// named in the MetadataKey header, or else the one mapped from the call's
+// :authority in Authorities.
+type GRPCProxy struct {
+	Enabled     bool              `yaml:"enabled"`
+	MetadataKey string            `yaml:"metadata_key"`
+	Authorities map[string]string `yaml:"authorities"`
+}
+
+// HTTPProxy is the sidecar's HTTP reverse proxy. It is off unless Listen is
+// set.
+type HTTPProxy struct {
+	Listen string  `yaml:"listen"`
+	Routes []Route `yaml:"routes"`
+}
+
+// Route sends requests matching Host and/or PathPrefix to a service.
+// PathPrefix matches whole path segments. When several routes match, the
+// one with the longest PathPrefix wins.
+type Route struct {
+	Host       string `yaml:"host"`
+	PathPrefix string `yaml:"path_prefix"`
+	Service    string `yaml:"service"`
+	// StripPrefix removes PathPrefix from the path sent to the backend.
+	StripPrefix bool `yaml:"strip_prefix"`
+	// PreserveHost sends the client's Host header instead of the backend's
+	// address.
+	PreserveHost  bool              `yaml:"preserve_host"`
+	SetHeaders    map[string]string `yaml:"set_headers"`
+	RemoveHeaders []string          `yaml:"remove_headers"`
+	Timeout       time.Duration     `yaml:"timeout"`
+}
+
+// Service lists its backends statically, or discovers them from the
+// EndpointSlices of a Kubernetes Service.
+type Service struct {
+	Name       string      `yaml:"name"`
+	Backends   []Backend   `yaml:"backends"`
+	Kubernetes *Kubernetes `yaml:"kubernetes"`
+	Metrics    Metrics     `yaml:"metrics"`
+	// Balancer is the balancing strategy; see package balancer. Defaults to
+	// metric-score.
+	Balancer string `yaml:"balancer"`
+	// Mode is what RouteRequest does with the chosen backend. Defaults to
+	// decision-only.
+	Mode string `yaml:"mode"`
+	// DecisionHold is how long a backend picked in decision-only mode
+	// counts as having a request in flight, standing in for the caller's
+	// request that the sidecar doesn't see end. Defaults to 1s; 0 releases
+	// it at once.
+	DecisionHold *time.Duration `yaml:"decision_hold"`
+	Probe        Probe          `yaml:"probe"`
+	Proxy        Proxy          `yaml:"proxy"`
+	HealthCheck  HealthCheck    `yaml:"health_check"`
+	// OutlierDetection ejects backends based on the requests the sidecar
+	// sends them in probe and proxy mode and through the HTTP and gRPC
+	// proxies.
+	OutlierDetection OutlierDetection `yaml:"outlier_detection"`
+	Retry            Retry            `yaml:"retry"`
+	CircuitBreaker   CircuitBreaker   `yaml:"circuit_breaker"`
+}
+
+// CircuitBreaker stops sending requests to a backend that keeps failing
+// them, without waiting for its metrics to catch up. The other fields only
+// apply if Enabled.
+type CircuitBreaker struct {
+	Enabled bool `yaml:"enabled"`
+	// ConsecutiveFailures opens the circuit after that many failures in a
+	// row.
+	ConsecutiveFailures int `yaml:"consecutive_failures"`
+	// FailureRatePercent opens the circuit once that share of the requests
+	// in the current Window failed, if there were at least MinRequests.
+	FailureRatePercent int           `yaml:"failure_rate_percent"`
+	MinRequests        int           `yaml:"min_requests"`
+	Window             time.Duration `yaml:"window"`
+	// OpenDuration is how long an open circuit rejects requests before it
+	// turns half-open.
+	OpenDuration time.Duration `yaml:"open_duration"`
+	// HalfOpenRequests is the number of trial requests let through at once
+	// by a half-open circuit. It closes after that many successes and opens
+	// again on any failure.
+	HalfOpenRequests int `yaml:"half_open_requests"`
+}
+
+// Retry sends a probe or proxied RouteRequest that failed to the next-best
+// backend that has not been tried yet.
+type Retry struct {
+	// MaxAttempts counts the first try too; 1 disables retries.
+	MaxAttempts int `yaml:"max_attempts"`
+	// PerTryTimeout bounds each attempt on top of the probe or proxy
+	// timeout. 0 leaves only those.
+	PerTryTimeout time.Duration `yaml:"per_try_timeout"`
+	// RetryableStatusCodes are the responses retried, besides connection
+	// errors and timeouts.
+	RetryableStatusCodes []int `yaml:"retryable_status_codes"`
+	// Attempts are spaced by a random back-off of up to BackoffBase,
+	// doubled for every retry up to BackoffMax.
+	BackoffBase time.Duration `yaml:"backoff_base"`
+	BackoffMax  time.Duration `yaml:"backoff_max"`
+	// BudgetPercent caps retries at this share of the service's requests
+	// over the last 10 seconds, past the first MinRetries. They are
+	// pointers so that an explicit 0 is kept rather than defaulted.
+	BudgetPercent *int `yaml:"budget_percent"`
+	MinRetries    *int `yaml:"min_retries"`
+}
+
+const (
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+	HealthCheckGRPC = "grpc"
+)
+
+// HealthCheck actively checks every backend of a service; only healthy
+// backends are balanced over. Checking is off unless Type is set.
+type HealthCheck struct {
+	// Type is http (a GET of Path must answer 2xx or 3xx), tcp (a connect
+	// must succeed) or grpc (grpc.health.v1 Check of GRPCService must answer
+	// SERVING).
+	Type        string        `yaml:"type"`
+	Path        string        `yaml:"path"`
+	GRPCService string        `yaml:"grpc_service"`
+	Interval    time.Duration `yaml:"interval"`
+	Timeout     time.Duration `yaml:"timeout"`
+	// HealthyThreshold and UnhealthyThreshold are the consecutive successes
+	// or failures it takes to change a backend's state.
+	HealthyThreshold   int `yaml:"healthy_threshold"`
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"`
+}
+
+// OutlierDetection temporarily ejects backends whose requests fail or are
+// much slower than their peers'. The other fields only apply if Enabled.
+type OutlierDetection struct {
+	Enabled bool `yaml:"enabled"`
+	// Interval is how often success rates and latencies are compared.
+	Interval time.Duration `yaml:"interval"`
+	// ConsecutiveErrors ejects a backend as soon as that many requests in a
+	// row fail.
+	ConsecutiveErrors int `yaml:"consecutive_errors"`
+	// A backend is ejected for BaseEjectionTime, doubled for every recent
+	// ejection up to MaxEjectionTime.
+	BaseEjectionTime time.Duration `yaml:"base_ejection_time"`
+	MaxEjectionTime  time.Duration `yaml:"max_ejection_time"`
+	// MaxEjectionPercent caps the share of backends ejected at once. At
+	// least one backend is always left in the pool.
+	MaxEjectionPercent int `yaml:"max_ejection_percent"`
+	// Success rate and latency outliers are only looked for among backends
+	// with MinRequests requests in the interval, and only if there are
+	// MinHosts of them.
+	MinHosts    int `yaml:"min_hosts"`
+	MinRequests int `yaml:"min_requests"`
+	// SuccessRateStdevFactor ejects backends whose success rate is this many
+	// standard deviations below the mean.
+	SuccessRateStdevFactor float64 `yaml:"success_rate_stdev_factor"`
+	// LatencyPercentile of each backend's latencies is compared with the
+	// median across backends; it is an outlier above LatencyFactor times
+	// that.
+	LatencyPercentile float64 `yaml:"latency_percentile"`
+	LatencyFactor     float64 `yaml:"latency_factor"`
+}
+
+const (
+	// ModeDecisionOnly returns the choice without contacting the backend.
+	ModeDecisionOnly = "decision-only"
+	// ModeProbe sends a request to the backend and reports its status.
+	ModeProbe = "probe"
+	// ModeProxy forwards the caller's request and returns the backend's
+	// response.
+	ModeProxy = "proxy"
+)
+
+type Probe struct {
+	Path    string        `yaml:"path"`
+	Method  string        `yaml:"method"`
+	Timeout time.Duration `yaml:"timeout"`
+	// ExpectedStatus fails the probe on any other status. 0 accepts any.
+	ExpectedStatus int `yaml:"expected_status"`
+}
+
+type Proxy struct {
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type Kubernetes struct {
+	Namespace string `yaml:"namespace"`
+	// Service defaults to the name of the enclosing service.
+	Service string `yaml:"service"`
+	// PortName picks the EndpointSlice port; the first port is used if empty.
+	PortName string `yaml:"port_name"`
+}
+
+const (
+	MetricsPrometheus    = "prometheus"
+	MetricsMetricsServer = "metrics-server"
+)
+
+type Metrics struct {
+	// Source is "prometheus" (the default) or "metrics-server".
+	Source string `yaml:"source"`
+	// Namespace of the backend pods for metrics-server. Defaults to the
+	// kubernetes discovery namespace, or "default".
+	Namespace string `yaml:"namespace"`
+}
+
+type Backend struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address"`
+	Port    int    `yaml:"port"`
+	// PodSelector is the regex matched against the Prometheus `pod` label.
+	// Defaults to "<name>.*".
+	PodSelector string `yaml:"pod_selector"`
+	Weight      int    `yaml:"weight"`
+}
+
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Listen == "" {
+		c.Listen = ":50051"
+	}
+	if c.GraphListen == "" {
+		c.GraphListen = ":8081"
+	}
+	if c.Log.Format == "" {
+		c.Log.Format = LogFormatText
+	}
+	if c.Log.Level == "" {
+		c.Log.Level = "info"
+	}
+	if c.Log.DecisionSampleRate <= 0 {
+		c.Log.DecisionSampleRate = 1
+	}
+	if c.Tracing.Endpoint == "" {
+		c.Tracing.Endpoint = "localhost:4317"
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "grpc-sidecar"
+	}
+	if c.Tracing.SampleRatio <= 0 {
+		c.Tracing.SampleRatio = 1
+	}
+	if c.MetricsListen == "" {
+		c.MetricsListen = ":9102"
+	}
+	if c.MaxHistory <= 0 {
+		c.MaxHistory = 10
+	}
+	if c.MetricsInterval <= 0 {
+		c.MetricsInterval = 5 * time.Second
+	}
+	if c.TLS.ClientAuth == "" {
+		c.TLS.ClientAuth = ClientAuthNone
+		if c.TLS.ClientCAFile != "" {
+			c.TLS.ClientAuth = ClientAuthRequire
+		}
+	}
+	if c.TLS.ReloadInterval <= 0 {
+		c.TLS.ReloadInterval = 30 * time.Second
+	}
+	if c.Auth.JWT.IdentityClaim == "" {
+		c.Auth.JWT.IdentityClaim = "sub"
+	}
+	if c.Readiness.MaxMetricsFailures <= 0 {
+		c.Readiness.MaxMetricsFailures = 3
+	}
+	if c.Shutdown.Timeout <= 0 {
+		c.Shutdown.Timeout = 25 * time.Second
+	}
+	if c.GRPCProxy.MetadataKey == "" {
+		c.GRPCProxy.MetadataKey = "x-sidecar-service"
+	}
+	for i := range c.HTTPProxy.Routes {
+		if c.HTTPProxy.Routes[i].Timeout <= 0 {
+			c.HTTPProxy.Routes[i].Timeout = 30 * time.Second
+		}
+	}
+	for i := range c.Services {
+		svc := &c.Services[i]
+		if k := svc.Kubernetes; k != nil {
+			if k.Namespace == "" {
+				k.Namespace = "default"
+			}
+			if k.Service == "" {
+				k.Service = svc.Name
+			}
+		}
+		if svc.Balancer == "" {
+			svc.Balancer = balancer.MetricScore
+		}
+		if svc.Mode == "" {
+			svc.Mode = ModeDecisionOnly
+		}
+		if svc.DecisionHold == nil {
+			hold := time.Second
+			svc.DecisionHold = &hold
+		}
+		if svc.Probe.Path == "" {
+			svc.Probe.Path = "/"
+		}
+		if svc.Probe.Method == "" {
+			svc.Probe.Method = "GET"
+		}
+		if svc.Probe.Timeout <= 0 {
+			svc.Probe.Timeout = 2 * time.Second
+		}
+		if svc.Proxy.Timeout <= 0 {
+			svc.Proxy.Timeout = 10 * time.Second
+		}
+		if hc := &svc.HealthCheck; hc.Type != "" {
+			if hc.Path == "" {
+				hc.Path = "/"
+			}
+			if hc.Interval <= 0 {
+				hc.Interval = 10 * time.Second
+			}
+			if hc.Timeout <= 0 {
+				hc.Timeout = 2 * time.Second
+			}
+			if hc.HealthyThreshold <= 0 {
+				hc.HealthyThreshold = 2
+			}
+			if hc.UnhealthyThreshold <= 0 {
+				hc.UnhealthyThreshold = 3
+			}
+		}
+		r := &svc.Retry
+		if r.MaxAttempts == 0 {
+			r.MaxAttempts = 3
+		}
+		if r.RetryableStatusCodes == nil {
+			r.RetryableStatusCodes = []int{502, 503, 504}
+		}
+		if r.BackoffBase <= 0 {
+			r.BackoffBase = 25 * time.Millisecond
+		}
+		if r.BackoffMax <= 0 {
+			r.BackoffMax = 250 * time.Millisecond
+		}
+		if r.BudgetPercent == nil {
+			percent := 20
+			r.BudgetPercent = &percent
+		}
+		if r.MinRetries == nil {
+			minRetries := 3
+			r.MinRetries = &minRetries
+		}
+		if cb := &svc.CircuitBreaker; cb.Enabled {
+			if cb.ConsecutiveFailures <= 0 {
+				cb.ConsecutiveFailures = 5
+			}
+			if cb.FailureRatePercent <= 0 {
+				cb.FailureRatePercent = 50
+			}
+			if cb.MinRequests <= 0 {
+				cb.MinRequests = 20
+			}
+			if cb.Window <= 0 {
+				cb.Window = 10 * time.Second
+			}
+			if cb.OpenDuration <= 0 {
+				cb.OpenDuration = 30 * time.Second
+			}
+			if cb.HalfOpenRequests <= 0 {
+				cb.HalfOpenRequests = 3
+			}
+		}
+		if od := &svc.OutlierDetection; od.Enabled {
+			if od.Interval <= 0 {
+				od.Interval = 10 * time.Second
+			}
+			if od.ConsecutiveErrors <= 0 {
+				od.ConsecutiveErrors = 5
+			}
+			if od.BaseEjectionTime <= 0 {
+				od.BaseEjectionTime = 30 * time.Second
+			}
+			if od.MaxEjectionTime <= 0 {
+				od.MaxEjectionTime = 5 * time.Minute
+			}
+			if od.MaxEjectionPercent <= 0 {
+				od.MaxEjectionPercent = 50
+			}
+			if od.MinHosts <= 0 {
+				od.MinHosts = 3
+			}
+			if od.MinRequests <= 0 {
+				od.MinRequests = 20
+			}
+			if od.SuccessRateStdevFactor <= 0 {
+				od.SuccessRateStdevFactor = 1.9
+			}
+			if od.LatencyPercentile <= 0 {
+				od.LatencyPercentile = 99
+			}
+			if od.LatencyFactor <= 0 {
+				od.LatencyFactor = 3
+			}
+		}
+		if svc.Metrics.Source == "" {
+			svc.Metrics.Source = MetricsPrometheus
+		}
+		if svc.Metrics.Namespace == "" {
+			svc.Metrics.Namespace = "default"
+			if svc.Kubernetes != nil {
+				svc.Metrics.Namespace = svc.Kubernetes.Namespace
+			}
+		}
+		for j := range c.Services[i].Backends {
+			b := &c.Services[i].Backends[j]
+			if b.PodSelector == "" {
+				b.PodSelector = b.Name + ".*"
+			}
+			if b.Weight == 0 {
+				b.Weight = 1
+			}
+		}
+	}
+}
+
+func (c *Config) Validate() error {
+	if len(c.Services) == 0 {
+		return fmt.Errorf("at least one service is required")
+	}
+	if c.Log.Format != LogFormatText && c.Log.Format != LogFormatJSON {
+		return fmt.Errorf("unknown log format %q", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		return fmt.Errorf("unknown log level %q", c.Log.Level)
+	}
+	if c.Log.DecisionSampleRate > 1 {
+		return fmt.Errorf("log decision_sample_rate must be at most 1")
+	}
+	if c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample_ratio must be at most 1")
+	}
+	if c.Admin.Listen != "" && c.Admin.Token == "" && c.Admin.TokenFile == "" {
+		return fmt.Errorf("admin listen requires token or token_file")
+	}
+	if c.Admin.Token != "" && c.Admin.TokenFile != "" {
+		return fmt.Errorf("admin token and token_file are mutually exclusive")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert_file and key_file must be set together")
+	}
+	switch c.TLS.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthOptional, ClientAuthRequire:
+		if c.TLS.ClientCAFile == "" {
+			return fmt.Errorf("tls client_auth %s requires client_ca_file", c.TLS.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("unknown tls client_auth %q", c.TLS.ClientAuth)
+	}
+	if c.TLS.ClientCAFile != "" && !c.TLS.Enabled() {
+		return fmt.Errorf("tls client_ca_file requires cert_file and key_file")
+	}
+	if c.Shutdown.Delay < 0 {
+		return fmt.Errorf("shutdown delay must not be negative")
+	}
+	services := map[string]bool{}
+	for _, svc := range c.Services {
+		if svc.Name == "" {
+			return fmt.Errorf("service with empty name")
+		}
+		if services[svc.Name] {
+			return fmt.Errorf("duplicate service %q", svc.Name)
+		}
+		services[svc.Name] = true
+		switch svc.Metrics.Source {
+		case MetricsPrometheus:
+			if c.PrometheusURL == "" {
+				return fmt.Errorf("service %q: prometheus_url is required for prometheus metrics", svc.Name)
+			}
+		case MetricsMetricsServer:
+		default:
+			return fmt.Errorf("service %q: unknown metrics source %q", svc.Name, svc.Metrics.Source)
+		}
+		switch svc.Mode {
+		case ModeDecisionOnly, ModeProbe, ModeProxy:
+		default:
+			return fmt.Errorf("service %q: unknown mode %q", svc.Name, svc.Mode)
+		}
+		if svc.DecisionHold != nil && *svc.DecisionHold < 0 {
+			return fmt.Errorf("service %q: decision_hold must not be negative", svc.Name)
+		}
+		if !strings.HasPrefix(svc.Probe.Path, "/") {
+			return fmt.Errorf("service %q: probe path %q must start with /", svc.Name, svc.Probe.Path)
+		}
+		switch svc.HealthCheck.Type {
+		case "", HealthCheckHTTP, HealthCheckTCP, HealthCheckGRPC:
+		default:
+			return fmt.Errorf("service %q: unknown health check type %q", svc.Name, svc.HealthCheck.Type)
+		}
+		if svc.Retry.MaxAttempts < 1 {
+			return fmt.Errorf("service %q: retry max_attempts must be at least 1", svc.Name)
+		}
+		if r := svc.Retry; (r.BudgetPercent != nil && *r.BudgetPercent < 0) || (r.MinRetries != nil && *r.MinRetries < 0) {
+			return fmt.Errorf("service %q: retry budget must not be negative", svc.Name)
+		}
+		for _, code := range svc.Retry.RetryableStatusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("service %q: invalid retryable status code %d", svc.Name, code)
+			}
+		}
+		if svc.CircuitBreaker.FailureRatePercent > 100 {
+			return fmt.Errorf("service %q: failure_rate_percent must be at most 100", svc.Name)
+		}
+		if od := svc.OutlierDetection; od.Enabled {
+			if od.MaxEjectionPercent > 100 {
+				return fmt.Errorf("service %q: max_ejection_percent must be at most 100", svc.Name)
+			}
+			if od.LatencyPercentile > 100 {
+				return fmt.Errorf("service %q: latency_percentile must be at most 100", svc.Name)
+			}
+			if od.MaxEjectionTime < od.BaseEjectionTime {
+				return fmt.Errorf("service %q: max_ejection_time is shorter than base_ejection_time", svc.Name)
+			}
+		}
+		if !balancer.Known(svc.Balancer) {
+			return fmt.Errorf("service %q: unknown balancer %q", svc.Name, svc.Balancer)
+		}
+		if svc.Kubernetes != nil && len(svc.Backends) > 0 {
+			return fmt.Errorf("service %q: backends and kubernetes discovery are mutually exclusive", svc.Name)
+		}
+		if svc.Kubernetes == nil && len(svc.Backends) == 0 {
+			return fmt.Errorf("service %q has no backends", svc.Name)
+		}
+		backends := map[string]bool{}
+		for _, b := range svc.Backends {
+			if b.Name == "" {
+				return fmt.Errorf("service %q: backend with empty name", svc.Name)
+			}
+			if backends[b.Name] {
+				return fmt.Errorf("service %q: duplicate backend %q", svc.Name, b.Name)
+			}
+			backends[b.Name] = true
+			if b.Address == "" {
+				return fmt.Errorf("service %q: backend %q has no address", svc.Name, b.Name)
+			}
+			if b.Port <= 0 || b.Port > 65535 {
+				return fmt.Errorf("service %q: backend %q has invalid port %d", svc.Name, b.Name, b.Port)
+			}
+			if b.Weight < 0 {
+				return fmt.Errorf("service %q: backend %q has negative weight", svc.Name, b.Name)
+			}
+		}
+	}
+	for i, r := range c.HTTPProxy.Routes {
+		if r.Host == "" && r.PathPrefix == "" {
+			return fmt.Errorf("http_proxy route %d: host or path_prefix is required", i)
+		}
+		if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+			return fmt.Errorf("http_proxy route %d: path_prefix %q must start with /", i, r.PathPrefix)
+		}
+		if !services[r.Service] {
+			return fmt.Errorf("http_proxy route %d: unknown service %q", i, r.Service)
+		}
+	}
+	for authority, svc := range c.GRPCProxy.Authorities {
+		if !services[svc] {
+			return fmt.Errorf("grpc_proxy authority %q: unknown service %q", authority, svc)
+		}
+	}
+	for i, t := range c.Auth.Tokens {
+		if t.Identity == "" {
+			return fmt.Errorf("auth token %d: identity is required", i)
+		}
+		if (t.Token == "") == (t.TokenFile == "") {
+			return fmt.Errorf("auth token %d: exactly one of token and token_file is required", i)
+		}
+	}
+	if c.Auth.MTLS && c.TLS.ClientCAFile == "" {
+		return fmt.Errorf("auth mtls requires tls client_ca_file")
+	}
+	if len(c.Auth.Policy) > 0 && !c.Auth.Enabled() {
+		return fmt.Errorf("auth policy requires tokens, jwt or mtls")
+	}
+	for i, r := range c.Auth.Policy {
+		if r.Identity == "" {
+			return fmt.Errorf("auth policy rule %d: identity is required", i)
+		}
+		for _, svc := range r.Services {
+			if svc != "*" && !services[svc] {
+				return fmt.Errorf("auth policy rule %d: unknown service %q", i, svc)
+			}
+		}
+	}
+	return nil
+}
+
+// UsesKubernetes reports whether any service discovers its backends from
+// the Kubernetes API.
+func (c *Config) UsesKubernetes() bool {
+	for _, svc := range c.Services {
+		if svc.Kubernetes != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// UsesMetricsServer reports whether any service reads metrics.k8s.io.
+func (c *Config) UsesMetricsServer() bool {
+	for _, svc := range c.Services {
+		if svc.Metrics.Source == MetricsMetricsServer {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Config) Service(name string) (*Service, bool) {
+	for i := range c.Services {
+		if c.Services[i].Name == name {
+			return &c.Services[i], true
+		}
+	}
+	return nil, false
+}
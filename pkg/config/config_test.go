@@ -0,0 +1,264 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const minimal = `
+prometheus_url: http://prometheus:9090
+services:
+  - name: cart
+    backends:
+      - name: cart-1
+        address: 10.0.0.1
+        port: 8080
+`
+
+func TestDefaults(t *testing.T) {
+	cfg, err := Parse([]byte(minimal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := cfg.Services[0]
+	b := svc.Backends[0]
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"listen", cfg.Listen, ":50051"},
+		{"graph_listen", cfg.GraphListen, ":8081"},
+		{"metrics_listen", cfg.MetricsListen, ":9102"},
+		{"max_history", cfg.MaxHistory, 10},
+		{"metrics_interval", cfg.MetricsInterval, 5 * time.Second},
+		{"log.format", cfg.Log.Format, LogFormatText},
+		{"log.level", cfg.Log.Level, "info"},
+		{"log.decision_sample_rate", cfg.Log.DecisionSampleRate, 1.0},
+		{"tls.client_auth", cfg.TLS.ClientAuth, ClientAuthNone},
+		{"shutdown.timeout", cfg.Shutdown.Timeout, 25 * time.Second},
+		{"grpc_proxy.metadata_key", cfg.GRPCProxy.MetadataKey, "x-sidecar-service"},
+		{"balancer", svc.Balancer, "metric-score"},
+		{"mode", svc.Mode, ModeDecisionOnly},
+		{"decision_hold", *svc.DecisionHold, time.Second},
+		{"probe.path", svc.Probe.Path, "/"},
+		{"probe.method", svc.Probe.Method, "GET"},
+		{"probe.timeout", svc.Probe.Timeout, 2 * time.Second},
+		{"proxy.timeout", svc.Proxy.Timeout, 10 * time.Second},
+		{"retry.max_attempts", svc.Retry.MaxAttempts, 3},
+		{"retry.retryable_status_codes", svc.Retry.RetryableStatusCodes, []int{502, 503, 504}},
+		{"retry.budget_percent", *svc.Retry.BudgetPercent, 20},
+		{"retry.min_retries", *svc.Retry.MinRetries, 3},
+		{"metrics.source", svc.Metrics.Source, MetricsPrometheus},
+		{"metrics.namespace", svc.Metrics.Namespace, "default"},
+		{"health_check", svc.HealthCheck, HealthCheck{}},
+		{"circuit_breaker", svc.CircuitBreaker, CircuitBreaker{}},
+		{"outlier_detection", svc.OutlierDetection, OutlierDetection{}},
+		{"pod_selector", b.PodSelector, "cart-1.*"},
+		{"weight", b.Weight, 1},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestSectionDefaults(t *testing.T) {
+	cfg, err := Parse([]byte(`
+services:
+  - name: cart
+    kubernetes: {}
+    metrics:
+      source: metrics-server
+    health_check:
+      type: http
+    circuit_breaker:
+      enabled: true
+    outlier_detection:
+      enabled: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := cfg.Services[0]
+	if *svc.Kubernetes != (Kubernetes{Namespace: "default", Service: "cart"}) {
+		t.Errorf("kubernetes = %+v", *svc.Kubernetes)
+	}
+	if svc.Metrics.Namespace != "default" {
+		t.Errorf("metrics namespace = %q, want the Service's", svc.Metrics.Namespace)
+	}
+	if want := (HealthCheck{Type: HealthCheckHTTP, Path: "/", Interval: 10 * time.Second, Timeout: 2 * time.Second,
+		HealthyThreshold: 2, UnhealthyThreshold: 3}); svc.HealthCheck != want {
+		t.Errorf("health_check = %+v, want %+v", svc.HealthCheck, want)
+	}
+	if want := (CircuitBreaker{Enabled: true, ConsecutiveFailures: 5, FailureRatePercent: 50, MinRequests: 20,
+		Window: 10 * time.Second, OpenDuration: 30 * time.Second, HalfOpenRequests: 3}); svc.CircuitBreaker != want {
+		t.Errorf("circuit_breaker = %+v, want %+v", svc.CircuitBreaker, want)
+	}
+	if want := (OutlierDetection{Enabled: true, Interval: 10 * time.Second, ConsecutiveErrors: 5,
+		BaseEjectionTime: 30 * time.Second, MaxEjectionTime: 5 * time.Minute, MaxEjectionPercent: 50,
+		MinHosts: 3, MinRequests: 20, SuccessRateStdevFactor: 1.9, LatencyPercentile: 99, LatencyFactor: 3}); svc.OutlierDetection != want {
+		t.Errorf("outlier_detection = %+v, want %+v", svc.OutlierDetection, want)
+	}
+}
+
+func TestExplicitZerosAreKept(t *testing.T) {
+	cfg, err := Parse([]byte(minimal + `    decision_hold: 0s
+    retry:
+      budget_percent: 0
+      min_retries: 0
+      retryable_status_codes: []
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := cfg.Services[0]
+	if *svc.DecisionHold != 0 || *svc.Retry.BudgetPercent != 0 || *svc.Retry.MinRetries != 0 || len(svc.Retry.RetryableStatusCodes) != 0 {
+		t.Errorf("explicit zeros were replaced: decision_hold %v, retry %+v, budget %d, min_retries %d",
+			*svc.DecisionHold, svc.Retry, *svc.Retry.BudgetPercent, *svc.Retry.MinRetries)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"no services", `prometheus_url: http://p`, "at least one service"},
+		{"service without name", `
+prometheus_url: http://p
+services:
+  - backends: [{name: a, address: 10.0.0.1, port: 80}]
+`, "service with empty name"},
+		{"duplicate service", `
+prometheus_url: http://p
+services:
+  - name: cart
+    backends: [{name: a, address: 10.0.0.1, port: 80}]
+  - name: cart
+    backends: [{name: b, address: 10.0.0.2, port: 80}]
+`, `duplicate service "cart"`},
+		{"duplicate backend", `
+prometheus_url: http://p
+services:
+  - name: cart
+    backends:
+      - {name: a, address: 10.0.0.1, port: 80}
+      - {name: a, address: 10.0.0.2, port: 80}
+`, `duplicate backend "a"`},
+		{"no backends", `
+prometheus_url: http://p
+services:
+  - name: cart
+`, "has no backends"},
+		{"backend without name", `
+prometheus_url: http://p
+services:
+  - name: cart
+    backends: [{address: 10.0.0.1, port: 80}]
+`, "backend with empty name"},
+		{"backend without address", `
+prometheus_url: http://p
+services:
+  - name: cart
+    backends: [{name: a, port: 80}]
+`, "has no address"},
+		{"backend without port", `
+prometheus_url: http://p
+services:
+  - name: cart
+    backends: [{name: a, address: 10.0.0.1}]
+`, "invalid port 0"},
+		{"no prometheus_url", `
+services:
+  - name: cart
+    backends: [{name: a, address: 10.0.0.1, port: 80}]
+`, "prometheus_url is required"},
+		{"backends and kubernetes", `
+prometheus_url: http://p
+services:
+  - name: cart
+    kubernetes: {}
+    backends: [{name: a, address: 10.0.0.1, port: 80}]
+`, "mutually exclusive"},
+		{"unknown balancer", minimal + "    balancer: fastest\n", `unknown balancer "fastest"`},
+		{"unknown mode", minimal + "    mode: forward\n", `unknown mode "forward"`},
+		{"unknown health check", minimal + "    health_check: {type: icmp}\n", `unknown health check type "icmp"`},
+		{"unknown metrics source", minimal + "    metrics: {source: statsd}\n", `unknown metrics source "statsd"`},
+		{"negative retry budget", minimal + "    retry: {budget_percent: -1}\n", "retry budget must not be negative"},
+		{"negative decision hold", minimal + "    decision_hold: -1s\n", "decision_hold must not be negative"},
+		{"route to unknown service", minimal + `
+http_proxy:
+  routes:
+    - {path_prefix: /, service: orders}
+`, `unknown service "orders"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse: %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONAndYAML(t *testing.T) {
+	const asJSON = `{
+  "prometheus_url": "http://prometheus:9090",
+  "services": [
+    {
+      "name": "cart",
+      "balancer": "round-robin",
+      "retry": {"max_attempts": 2, "per_try_timeout": "500ms"},
+      "backends": [{"name": "cart-1", "address": "10.0.0.1", "port": 8080, "weight": 2}]
+    }
+  ]
+}`
+	const asYAML = `
+prometheus_url: http://prometheus:9090
+services:
+  - name: cart
+    balancer: round-robin
+    retry:
+      max_attempts: 2
+      per_try_timeout: 500ms
+    backends:
+      - name: cart-1
+        address: 10.0.0.1
+        port: 8080
+        weight: 2
+`
+	dir := t.TempDir()
+	load := func(name, data string) *Config {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return cfg
+	}
+	fromJSON, fromYAML := load("config.json", asJSON), load("config.yaml", asYAML)
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Errorf("JSON and YAML differ:\n%+v\n%+v", fromJSON, fromYAML)
+	}
+	if svc := fromJSON.Services[0]; svc.Retry.PerTryTimeout != 500*time.Millisecond || svc.Backends[0].Weight != 2 {
+		t.Errorf("JSON service = %+v", svc)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("no error for a missing file")
+	}
+	if _, err := Parse([]byte(`{"services": [`)); err == nil {
+		t.Error("no error for malformed JSON")
+	}
+}
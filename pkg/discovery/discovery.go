@@ -0,0 +1,90 @@
+package discovery
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"try/pkg/config"
+)
+
+// Backend is a single routable replica of a service.
+type Backend struct {
+	Name        string
+	Address     string
+	Port        int
+	PodSelector string
+	Weight      int
+}
+
+func (b Backend) URL() string {
+	return "http://" + net.JoinHostPort(b.Address, strconv.Itoa(b.Port))
+}
+
+// Source provides the current backends of a service. Implementations must be
+// safe for concurrent use.
+type Source interface {
+	Backends() []Backend
+	// Changed returns a channel that is closed the next time the backends
+	// change.
+	Changed() <-chan struct{}
+}
+
+// Static returns a Source for the backends listed in the config file.
+func Static(backends []config.Backend) Source {
+	set := &BackendSet{}
+	var bs []Backend
+	for _, b := range backends {
+		bs = append(bs, Backend{
+			Name:        b.Name,
+			Address:     b.Address,
+			Port:        b.Port,
+			PodSelector: b.PodSelector,
+			Weight:      b.Weight,
+		})
+	}
+	set.Set(bs)
+	return set
+}
+
+// BackendSet is a concurrency-safe, replaceable list of backends.
+type BackendSet struct {
+	mu       sync.RWMutex
+	backends []Backend
+	changed  chan struct{}
+}
+
+func (s *BackendSet) Backends() []Backend {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Backend(nil), s.backends...)
+}
+
+func (s *BackendSet) Changed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.changed == nil {
+		s.changed = make(chan struct{})
+	}
+	return s.changed
+}
+
+// Set replaces the backends, keeping them sorted by name so that callers see
+// a stable order regardless of how they were discovered.
+func (s *BackendSet) Set(backends []Backend) {
+	bs := append([]Backend(nil), backends...)
+	sort.Slice(bs, func(i, j int) bool { return bs[i].Name < bs[j].Name })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reflect.DeepEqual(s.backends, bs) {
+		return
+	}
+	s.backends = bs
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
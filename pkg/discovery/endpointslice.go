@@ -0,0 +1,211 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watcher keeps a BackendSet per Kubernetes Service up to date from the
+// EndpointSlices of that Service.
+type Watcher struct {
+	client kubernetes.Interface
+	resync time.Duration
+
+	mu      sync.Mutex
+	watches []*sliceWatch
+	stopped bool
+}
+
+type sliceWatch struct {
+	namespace string
+	service   string
+	portName  string
+	factory   informers.SharedInformerFactory
+	lister    discoverylisters.EndpointSliceLister
+	synced    cache.InformerSynced
+	set       *BackendSet
+	// stop ends the informer.
+	stop chan struct{}
+}
+
+func NewWatcher(client kubernetes.Interface, resync time.Duration) *Watcher {
+	return &Watcher{client: client, resync: resync}
+}
+
+// Watch registers a Service and returns the BackendSet that will track its
+// ready endpoints. portName selects the EndpointSlice port; if empty the
+// first port is used. Watching the same Service and port again returns the
+// same BackendSet. A Service watched after Start is only tracked once Start
+// is called again.
+func (w *Watcher) Watch(namespace, service, portName string) *BackendSet {
+	w.mu.Lock()
+	for _, sw := range w.watches {
+		if sw.namespace == namespace && sw.service == service && sw.portName == portName {
+			w.mu.Unlock()
+			return sw.set
+		}
+	}
+	w.mu.Unlock()
+
+	selector := labels.Set{discoveryv1.LabelServiceName: service}.String()
+	factory := informers.NewSharedInformerFactoryWithOptions(w.client, w.resync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = selector
+		}),
+	)
+	informer := factory.Discovery().V1().EndpointSlices()
+
+	sw := &sliceWatch{
+		namespace: namespace,
+		service:   service,
+		portName:  portName,
+		factory:   factory,
+		lister:    informer.Lister(),
+		synced:    informer.Informer().HasSynced,
+		set:       &BackendSet{},
+		stop:      make(chan struct{}),
+	}
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { sw.rebuild() },
+		UpdateFunc: func(interface{}, interface{}) { sw.rebuild() },
+		DeleteFunc: func(interface{}) { sw.rebuild() },
+	})
+
+	w.mu.Lock()
+	w.watches = append(w.watches, sw)
+	w.mu.Unlock()
+	return sw.set
+}
+
+// Start runs the informers that are not running yet and waits up to ctx's
+// deadline for the initial list of every watched Service.
+func (w *Watcher) Start(ctx context.Context) error {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return fmt.Errorf("watcher is stopped")
+	}
+	watches := append([]*sliceWatch(nil), w.watches...)
+	w.mu.Unlock()
+
+	for _, sw := range watches {
+		sw.factory.Start(sw.stop)
+	}
+	for _, sw := range watches {
+		if !cache.WaitForCacheSync(ctx.Done(), sw.synced) {
+			return fmt.Errorf("timed out syncing EndpointSlices for %s/%s", sw.namespace, sw.service)
+		}
+		sw.rebuild()
+	}
+	return nil
+}
+
+// Retain stops watching the Services whose BackendSet is not in sets.
+func (w *Watcher) Retain(sets []*BackendSet) {
+	keep := map[*BackendSet]bool{}
+	for _, set := range sets {
+		keep[set] = true
+	}
+	w.mu.Lock()
+	var kept, dropped []*sliceWatch
+	for _, sw := range w.watches {
+		if keep[sw.set] {
+			kept = append(kept, sw)
+		} else {
+			dropped = append(dropped, sw)
+		}
+	}
+	w.watches = kept
+	w.mu.Unlock()
+
+	for _, sw := range dropped {
+		sw.shutdown()
+	}
+}
+
+func (w *Watcher) Stop() {
+	w.mu.Lock()
+	watches := w.watches
+	w.watches, w.stopped = nil, true
+	w.mu.Unlock()
+
+	for _, sw := range watches {
+		sw.shutdown()
+	}
+}
+
+// shutdown stops the informer and waits for it to finish.
+func (sw *sliceWatch) shutdown() {
+	close(sw.stop)
+	sw.factory.Shutdown()
+}
+
+func (sw *sliceWatch) rebuild() {
+	slices, err := sw.lister.EndpointSlices(sw.namespace).List(labels.Everything())
+	if err != nil {
+		slog.Warn("failed to list EndpointSlices", "namespace", sw.namespace, "service", sw.service, "error", err)
+		return
+	}
+
+	seen := map[string]bool{}
+	var backends []Backend
+	for _, slice := range slices {
+		port, ok := slicePort(slice, sw.portName)
+		if !ok {
+			continue
+		}
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if len(ep.Addresses) == 0 {
+				continue
+			}
+			addr := ep.Addresses[0]
+			// The same endpoint can appear in more than one slice while the
+			// controller is moving it around.
+			if seen[addr] {
+				continue
+			}
+			seen[addr] = true
+
+			name := addr
+			if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+				name = ep.TargetRef.Name
+			}
+			backends = append(backends, Backend{
+				Name:        name,
+				Address:     addr,
+				Port:        port,
+				PodSelector: regexp.QuoteMeta(name),
+				Weight:      1,
+			})
+		}
+	}
+	sw.set.Set(backends)
+}
+
+func slicePort(slice *discoveryv1.EndpointSlice, name string) (int, bool) {
+	for _, p := range slice.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if name == "" || (p.Name != nil && *p.Name == name) {
+			return int(*p.Port), true
+		}
+	}
+	return 0, false
+}
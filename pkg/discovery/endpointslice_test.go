@@ -0,0 +1,264 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type endpoint struct {
+	pod, addr string
+	ready     bool
+}
+
+func slice(name, service string, ports map[string]int32, endpoints ...endpoint) *discoveryv1.EndpointSlice {
+	s := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "shop",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+	for portName, port := range ports {
+		s.Ports = append(s.Ports, discoveryv1.EndpointPort{Name: &portName, Port: &port})
+	}
+	for _, e := range endpoints {
+		s.Endpoints = append(s.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{e.addr},
+			Conditions: discoveryv1.EndpointConditions{Ready: &e.ready},
+			TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: e.pod},
+		})
+	}
+	return s
+}
+
+func backend(pod, addr string, port int) Backend {
+	return Backend{Name: pod, Address: addr, Port: port, PodSelector: pod, Weight: 1}
+}
+
+// startWatcher watches the cart Service's port portName and waits until the
+// informer's watch is established, so that no later change is missed.
+func startWatcher(t *testing.T, client *fake.Clientset, portName string) *BackendSet {
+	t.Helper()
+	watching := make(chan struct{})
+	var once sync.Once
+	client.PrependWatchReactor("endpointslices", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		defer once.Do(func() { close(watching) })
+		w, err := client.Tracker().Watch(action.GetResource(), action.GetNamespace())
+		return true, w, err
+	})
+
+	w := NewWatcher(client, 0)
+	set := w.Watch("shop", "cart", portName)
+	t.Cleanup(w.Stop)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-watching:
+	case <-ctx.Done():
+		t.Fatal("informer never started watching")
+	}
+	return set
+}
+
+func waitForBackends(t *testing.T, set *BackendSet, want []Backend) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		changed := set.Changed()
+		got := set.Backends()
+		if reflect.DeepEqual(got, want) || (len(got) == 0 && len(want) == 0) {
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("backends = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestWatcherTracksEndpointSlices(t *testing.T) {
+	ports := map[string]int32{"http": 8080}
+	client := fake.NewSimpleClientset(
+		slice("cart-a", "cart", ports, endpoint{"cart-1", "10.0.0.1", true}),
+		// Another Service's slice in the same namespace.
+		slice("orders-a", "orders", ports, endpoint{"orders-1", "10.0.1.1", true}),
+	)
+	set := startWatcher(t, client, "")
+	waitForBackends(t, set, []Backend{backend("cart-1", "10.0.0.1", 8080)})
+
+	ctx := context.Background()
+	slices := client.DiscoveryV1().EndpointSlices("shop")
+
+	// Scale up: a second pod joins the slice, a third comes up not ready.
+	_, err := slices.Update(ctx, slice("cart-a", "cart", ports,
+		endpoint{"cart-1", "10.0.0.1", true},
+		endpoint{"cart-2", "10.0.0.2", true},
+		endpoint{"cart-3", "10.0.0.3", false},
+	), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForBackends(t, set, []Backend{
+		backend("cart-1", "10.0.0.1", 8080),
+		backend("cart-2", "10.0.0.2", 8080),
+	})
+
+	// A new slice, repeating cart-2 as the controller moves it over.
+	_, err = slices.Create(ctx, slice("cart-b", "cart", ports,
+		endpoint{"cart-2", "10.0.0.2", true},
+		endpoint{"cart-4", "10.0.0.4", true},
+	), metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForBackends(t, set, []Backend{
+		backend("cart-1", "10.0.0.1", 8080),
+		backend("cart-2", "10.0.0.2", 8080),
+		backend("cart-4", "10.0.0.4", 8080),
+	})
+
+	// cart-3 becomes ready.
+	_, err = slices.Update(ctx, slice("cart-a", "cart", ports,
+		endpoint{"cart-1", "10.0.0.1", true},
+		endpoint{"cart-2", "10.0.0.2", true},
+		endpoint{"cart-3", "10.0.0.3", true},
+	), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForBackends(t, set, []Backend{
+		backend("cart-1", "10.0.0.1", 8080),
+		backend("cart-2", "10.0.0.2", 8080),
+		backend("cart-3", "10.0.0.3", 8080),
+		backend("cart-4", "10.0.0.4", 8080),
+	})
+
+	// Pods are deleted: cart-1 leaves its slice and cart-b goes away.
+	_, err = slices.Update(ctx, slice("cart-a", "cart", ports,
+		endpoint{"cart-2", "10.0.0.2", true},
+		endpoint{"cart-3", "10.0.0.3", true},
+	), metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := slices.Delete(ctx, "cart-b", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForBackends(t, set, []Backend{
+		backend("cart-2", "10.0.0.2", 8080),
+		backend("cart-3", "10.0.0.3", 8080),
+	})
+
+	if err := slices.Delete(ctx, "cart-a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	waitForBackends(t, set, nil)
+}
+
+func TestWatcherSelectsPortByName(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		slice("cart-a", "cart", map[string]int32{"http": 8080, "grpc": 9090}, endpoint{"cart-1", "10.0.0.1", true}),
+		// A slice without the port is skipped.
+		slice("cart-b", "cart", map[string]int32{"http": 8080}, endpoint{"cart-2", "10.0.0.2", true}),
+	)
+	set := startWatcher(t, client, "grpc")
+	waitForBackends(t, set, []Backend{backend("cart-1", "10.0.0.1", 9090)})
+}
+
+func TestWatchReturnsTheSameSet(t *testing.T) {
+	w := NewWatcher(fake.NewSimpleClientset(), 0)
+	defer w.Stop()
+	if w.Watch("shop", "cart", "http") != w.Watch("shop", "cart", "http") {
+		t.Error("watching the same Service and port twice gave two sets")
+	}
+	if w.Watch("shop", "cart", "http") == w.Watch("shop", "cart", "grpc") {
+		t.Error("watching two ports gave the same set")
+	}
+}
+
+// fakeWatches makes client's EndpointSlice watches fakes that can be
+// inspected, listed by namespace.
+func fakeWatches(client *fake.Clientset) func(namespace string) []*watch.FakeWatcher {
+	var mu sync.Mutex
+	watches := map[string][]*watch.FakeWatcher{}
+	client.PrependWatchReactor("endpointslices", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fw := watch.NewFake()
+		watches[action.GetNamespace()] = append(watches[action.GetNamespace()], fw)
+		return true, fw, nil
+	})
+	return func(namespace string) []*watch.FakeWatcher {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*watch.FakeWatcher(nil), watches[namespace]...)
+	}
+}
+
+// watching reports whether one of watches is still open, waiting a while
+// for them to be stopped if want is false.
+func watching(watches func() []*watch.FakeWatcher, want bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		open := false
+		for _, fw := range watches() {
+			if !fw.IsStopped() {
+				open = true
+			}
+		}
+		if open == want || time.Now().After(deadline) {
+			return open
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRetainStopsUnusedWatches(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	watches := fakeWatches(client)
+	w := NewWatcher(client, 0)
+	defer w.Stop()
+	cart := w.Watch("shop", "cart", "")
+	w.Watch("other", "orders", "")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	inShop := func() []*watch.FakeWatcher { return watches("shop") }
+	inOther := func() []*watch.FakeWatcher { return watches("other") }
+	if !watching(inShop, true) || !watching(inOther, true) {
+		t.Fatal("informers never started watching")
+	}
+
+	w.Retain([]*BackendSet{cart})
+	if watching(inOther, false) {
+		t.Error("the orders watch is still open")
+	}
+	if !watching(inShop, true) {
+		t.Error("the cart watch was stopped")
+	}
+	if w.Watch("shop", "cart", "") != cart {
+		t.Error("the cart watch was forgotten")
+	}
+
+	w.Stop()
+	if watching(inShop, false) {
+		t.Error("the cart watch is still open after Stop")
+	}
+}
@@ -9,6 +9,7 @@ package grpcapi
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -22,8 +23,21 @@ const (
 )
 
 type RouteRequestRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	ServiceName   string                 `protobuf:"bytes,1,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	ServiceName string                 `protobuf:"bytes,1,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	// strategy overrides the service's balancing strategy for this call:
+	// metric-score, round-robin, weighted-round-robin, least-outstanding,
+	// power-of-two or random.
+	Strategy string `protobuf:"bytes,2,opt,name=strategy,proto3" json:"strategy,omitempty"`
+	// mode overrides the service's routing mode for this call: decision-only,
+	// probe or proxy.
+	Mode string `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	// method, path, headers and body are the request to forward in proxy mode.
+	// method defaults to POST if there is a body and GET otherwise.
+	Method        string            `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`
+	Path          string            `protobuf:"bytes,5,opt,name=path,proto3" json:"path,omitempty"`
+	Headers       map[string]string `protobuf:"bytes,6,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Body          []byte            `protobuf:"bytes,7,opt,name=body,proto3" json:"body,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -65,9 +79,74 @@ func (x *RouteRequestRequest) GetServiceName() string {
 	return ""
 }
 
+func (x *RouteRequestRequest) GetStrategy() string {
+	if x != nil {
+		return x.Strategy
+	}
+	return ""
+}
+
+func (x *RouteRequestRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *RouteRequestRequest) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *RouteRequestRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *RouteRequestRequest) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *RouteRequestRequest) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
 type RouteResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Backend       string                 `protobuf:"bytes,1,opt,name=backend,proto3" json:"backend,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// backend is the URL of the selected backend, or in probe and proxy mode
+	// of the backend that answered the last attempt.
+	Backend     string `protobuf:"bytes,1,opt,name=backend,proto3" json:"backend,omitempty"`
+	BackendName string `protobuf:"bytes,2,opt,name=backend_name,json=backendName,proto3" json:"backend_name,omitempty"`
+	Host        string `protobuf:"bytes,3,opt,name=host,proto3" json:"host,omitempty"`
+	Port        int32  `protobuf:"varint,4,opt,name=port,proto3" json:"port,omitempty"`
+	Score       *Score `protobuf:"bytes,5,opt,name=score,proto3" json:"score,omitempty"`
+	// fallbacks are the other backends of the service that were not tried,
+	// best first.
+	Fallbacks []*RankedBackend `protobuf:"bytes,6,rep,name=fallbacks,proto3" json:"fallbacks,omitempty"`
+	// status_code and latency are from the request RouteRequest sent to the
+	// selected backend in probe or proxy mode, and unset in decision-only mode.
+	StatusCode int32                `protobuf:"varint,7,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Latency    *durationpb.Duration `protobuf:"bytes,8,opt,name=latency,proto3" json:"latency,omitempty"`
+	// decision_id identifies this routing decision in the sidecar's logs.
+	DecisionId string `protobuf:"bytes,9,opt,name=decision_id,json=decisionId,proto3" json:"decision_id,omitempty"`
+	// mode is the routing mode the call was served in.
+	Mode string `protobuf:"bytes,10,opt,name=mode,proto3" json:"mode,omitempty"`
+	// body and headers are the backend's response in proxy mode.
+	Body    []byte            `protobuf:"bytes,11,opt,name=body,proto3" json:"body,omitempty"`
+	Headers map[string]string `protobuf:"bytes,12,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// attempts are the requests sent to backends in probe and proxy mode, in
+	// order; all but the last failed and were retried on the next backend.
+	Attempts      []*Attempt `protobuf:"bytes,13,rep,name=attempts,proto3" json:"attempts,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -109,17 +188,678 @@ func (x *RouteResponse) GetBackend() string {
 	return ""
 }
 
+func (x *RouteResponse) GetBackendName() string {
+	if x != nil {
+		return x.BackendName
+	}
+	return ""
+}
+
+func (x *RouteResponse) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *RouteResponse) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *RouteResponse) GetScore() *Score {
+	if x != nil {
+		return x.Score
+	}
+	return nil
+}
+
+func (x *RouteResponse) GetFallbacks() []*RankedBackend {
+	if x != nil {
+		return x.Fallbacks
+	}
+	return nil
+}
+
+func (x *RouteResponse) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *RouteResponse) GetLatency() *durationpb.Duration {
+	if x != nil {
+		return x.Latency
+	}
+	return nil
+}
+
+func (x *RouteResponse) GetDecisionId() string {
+	if x != nil {
+		return x.DecisionId
+	}
+	return ""
+}
+
+func (x *RouteResponse) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *RouteResponse) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *RouteResponse) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *RouteResponse) GetAttempts() []*Attempt {
+	if x != nil {
+		return x.Attempts
+	}
+	return nil
+}
+
+type Attempt struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	BackendName string                 `protobuf:"bytes,1,opt,name=backend_name,json=backendName,proto3" json:"backend_name,omitempty"`
+	Url         string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	// status_code is unset if the backend did not answer.
+	StatusCode    int32                `protobuf:"varint,3,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Latency       *durationpb.Duration `protobuf:"bytes,4,opt,name=latency,proto3" json:"latency,omitempty"`
+	Error         string               `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Attempt) Reset() {
+	*x = Attempt{}
+	mi := &file_control_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Attempt) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Attempt) ProtoMessage() {}
+
+func (x *Attempt) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Attempt.ProtoReflect.Descriptor instead.
+func (*Attempt) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Attempt) GetBackendName() string {
+	if x != nil {
+		return x.BackendName
+	}
+	return ""
+}
+
+func (x *Attempt) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Attempt) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *Attempt) GetLatency() *durationpb.Duration {
+	if x != nil {
+		return x.Latency
+	}
+	return nil
+}
+
+func (x *Attempt) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// Score is a backend's combined load score, lower is better, and the
+// weighted CPU, memory and network terms it is the sum of.
+type Score struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Total   float64                `protobuf:"fixed64,1,opt,name=total,proto3" json:"total,omitempty"`
+	Cpu     float64                `protobuf:"fixed64,2,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Memory  float64                `protobuf:"fixed64,3,opt,name=memory,proto3" json:"memory,omitempty"`
+	Network float64                `protobuf:"fixed64,4,opt,name=network,proto3" json:"network,omitempty"`
+	// errors is the penalty for requests that recently failed on the backend.
+	Errors        float64 `protobuf:"fixed64,5,opt,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Score) Reset() {
+	*x = Score{}
+	mi := &file_control_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Score) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Score) ProtoMessage() {}
+
+func (x *Score) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Score.ProtoReflect.Descriptor instead.
+func (*Score) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Score) GetTotal() float64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *Score) GetCpu() float64 {
+	if x != nil {
+		return x.Cpu
+	}
+	return 0
+}
+
+func (x *Score) GetMemory() float64 {
+	if x != nil {
+		return x.Memory
+	}
+	return 0
+}
+
+func (x *Score) GetNetwork() float64 {
+	if x != nil {
+		return x.Network
+	}
+	return 0
+}
+
+func (x *Score) GetErrors() float64 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+type RankedBackend struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Host          string                 `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
+	Port          int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	Url           string                 `protobuf:"bytes,4,opt,name=url,proto3" json:"url,omitempty"`
+	Score         *Score                 `protobuf:"bytes,5,opt,name=score,proto3" json:"score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RankedBackend) Reset() {
+	*x = RankedBackend{}
+	mi := &file_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RankedBackend) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RankedBackend) ProtoMessage() {}
+
+func (x *RankedBackend) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RankedBackend.ProtoReflect.Descriptor instead.
+func (*RankedBackend) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RankedBackend) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *RankedBackend) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *RankedBackend) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *RankedBackend) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *RankedBackend) GetScore() *Score {
+	if x != nil {
+		return x.Score
+	}
+	return nil
+}
+
+type WatchBackendsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServiceName   string                 `protobuf:"bytes,1,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchBackendsRequest) Reset() {
+	*x = WatchBackendsRequest{}
+	mi := &file_control_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchBackendsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchBackendsRequest) ProtoMessage() {}
+
+func (x *WatchBackendsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchBackendsRequest.ProtoReflect.Descriptor instead.
+func (*WatchBackendsRequest) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *WatchBackendsRequest) GetServiceName() string {
+	if x != nil {
+		return x.ServiceName
+	}
+	return ""
+}
+
+type BackendMetrics struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CpuUsage       float64                `protobuf:"fixed64,1,opt,name=cpu_usage,json=cpuUsage,proto3" json:"cpu_usage,omitempty"`
+	MemoryUsage    float64                `protobuf:"fixed64,2,opt,name=memory_usage,json=memoryUsage,proto3" json:"memory_usage,omitempty"`
+	NetworkTraffic float64                `protobuf:"fixed64,3,opt,name=network_traffic,json=networkTraffic,proto3" json:"network_traffic,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *BackendMetrics) Reset() {
+	*x = BackendMetrics{}
+	mi := &file_control_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BackendMetrics) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BackendMetrics) ProtoMessage() {}
+
+func (x *BackendMetrics) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BackendMetrics.ProtoReflect.Descriptor instead.
+func (*BackendMetrics) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BackendMetrics) GetCpuUsage() float64 {
+	if x != nil {
+		return x.CpuUsage
+	}
+	return 0
+}
+
+func (x *BackendMetrics) GetMemoryUsage() float64 {
+	if x != nil {
+		return x.MemoryUsage
+	}
+	return 0
+}
+
+func (x *BackendMetrics) GetNetworkTraffic() float64 {
+	if x != nil {
+		return x.NetworkTraffic
+	}
+	return 0
+}
+
+type BackendStatus struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Name    string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Host    string                 `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
+	Port    int32                  `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	Url     string                 `protobuf:"bytes,4,opt,name=url,proto3" json:"url,omitempty"`
+	Weight  int32                  `protobuf:"varint,5,opt,name=weight,proto3" json:"weight,omitempty"`
+	Metrics *BackendMetrics        `protobuf:"bytes,6,opt,name=metrics,proto3" json:"metrics,omitempty"`
+	// score is the combined load score; lower is better.
+	Score   float64 `protobuf:"fixed64,7,opt,name=score,proto3" json:"score,omitempty"`
+	Healthy bool    `protobuf:"varint,8,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	// ejected is set while outlier detection keeps the backend out of the
+	// pool.
+	Ejected bool `protobuf:"varint,9,opt,name=ejected,proto3" json:"ejected,omitempty"`
+	// circuit is the state of the backend's circuit breaker: closed, open or
+	// half-open. It is empty if circuit breaking is off.
+	Circuit       string `protobuf:"bytes,10,opt,name=circuit,proto3" json:"circuit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BackendStatus) Reset() {
+	*x = BackendStatus{}
+	mi := &file_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BackendStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BackendStatus) ProtoMessage() {}
+
+func (x *BackendStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BackendStatus.ProtoReflect.Descriptor instead.
+func (*BackendStatus) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *BackendStatus) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *BackendStatus) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *BackendStatus) GetPort() int32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *BackendStatus) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *BackendStatus) GetWeight() int32 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+func (x *BackendStatus) GetMetrics() *BackendMetrics {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *BackendStatus) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *BackendStatus) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+func (x *BackendStatus) GetEjected() bool {
+	if x != nil {
+		return x.Ejected
+	}
+	return false
+}
+
+func (x *BackendStatus) GetCircuit() string {
+	if x != nil {
+		return x.Circuit
+	}
+	return ""
+}
+
+type BackendsUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServiceName   string                 `protobuf:"bytes,1,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	Backends      []*BackendStatus       `protobuf:"bytes,2,rep,name=backends,proto3" json:"backends,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BackendsUpdate) Reset() {
+	*x = BackendsUpdate{}
+	mi := &file_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BackendsUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BackendsUpdate) ProtoMessage() {}
+
+func (x *BackendsUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BackendsUpdate.ProtoReflect.Descriptor instead.
+func (*BackendsUpdate) Descriptor() ([]byte, []int) {
+	return file_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BackendsUpdate) GetServiceName() string {
+	if x != nil {
+		return x.ServiceName
+	}
+	return ""
+}
+
+func (x *BackendsUpdate) GetBackends() []*BackendStatus {
+	if x != nil {
+		return x.Backends
+	}
+	return nil
+}
+
 var File_control_proto protoreflect.FileDescriptor
 
 const file_control_proto_rawDesc = "" +
 	"\n" +
-	"\rcontrol.proto\x12\agrpcapi\"8\n" +
+	"\rcontrol.proto\x12\agrpcapi\x1a\x1egoogle/protobuf/duration.proto\"\xa9\x02\n" +
 	"\x13RouteRequestRequest\x12!\n" +
-	"\fservice_name\x18\x01 \x01(\tR\vserviceName\")\n" +
+	"\fservice_name\x18\x01 \x01(\tR\vserviceName\x12\x1a\n" +
+	"\bstrategy\x18\x02 \x01(\tR\bstrategy\x12\x12\n" +
+	"\x04mode\x18\x03 \x01(\tR\x04mode\x12\x16\n" +
+	"\x06method\x18\x04 \x01(\tR\x06method\x12\x12\n" +
+	"\x04path\x18\x05 \x01(\tR\x04path\x12C\n" +
+	"\aheaders\x18\x06 \x03(\v2).grpcapi.RouteRequestRequest.HeadersEntryR\aheaders\x12\x12\n" +
+	"\x04body\x18\a \x01(\fR\x04body\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x98\x04\n" +
 	"\rRouteResponse\x12\x18\n" +
-	"\abackend\x18\x01 \x01(\tR\abackend2V\n" +
+	"\abackend\x18\x01 \x01(\tR\abackend\x12!\n" +
+	"\fbackend_name\x18\x02 \x01(\tR\vbackendName\x12\x12\n" +
+	"\x04host\x18\x03 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x04 \x01(\x05R\x04port\x12$\n" +
+	"\x05score\x18\x05 \x01(\v2\x0e.grpcapi.ScoreR\x05score\x124\n" +
+	"\tfallbacks\x18\x06 \x03(\v2\x16.grpcapi.RankedBackendR\tfallbacks\x12\x1f\n" +
+	"\vstatus_code\x18\a \x01(\x05R\n" +
+	"statusCode\x123\n" +
+	"\alatency\x18\b \x01(\v2\x19.google.protobuf.DurationR\alatency\x12\x1f\n" +
+	"\vdecision_id\x18\t \x01(\tR\n" +
+	"decisionId\x12\x12\n" +
+	"\x04mode\x18\n" +
+	" \x01(\tR\x04mode\x12\x12\n" +
+	"\x04body\x18\v \x01(\fR\x04body\x12=\n" +
+	"\aheaders\x18\f \x03(\v2#.grpcapi.RouteResponse.HeadersEntryR\aheaders\x12,\n" +
+	"\battempts\x18\r \x03(\v2\x10.grpcapi.AttemptR\battempts\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xaa\x01\n" +
+	"\aAttempt\x12!\n" +
+	"\fbackend_name\x18\x01 \x01(\tR\vbackendName\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12\x1f\n" +
+	"\vstatus_code\x18\x03 \x01(\x05R\n" +
+	"statusCode\x123\n" +
+	"\alatency\x18\x04 \x01(\v2\x19.google.protobuf.DurationR\alatency\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"y\n" +
+	"\x05Score\x12\x14\n" +
+	"\x05total\x18\x01 \x01(\x01R\x05total\x12\x10\n" +
+	"\x03cpu\x18\x02 \x01(\x01R\x03cpu\x12\x16\n" +
+	"\x06memory\x18\x03 \x01(\x01R\x06memory\x12\x18\n" +
+	"\anetwork\x18\x04 \x01(\x01R\anetwork\x12\x16\n" +
+	"\x06errors\x18\x05 \x01(\x01R\x06errors\"\x83\x01\n" +
+	"\rRankedBackend\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04host\x18\x02 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\x05R\x04port\x12\x10\n" +
+	"\x03url\x18\x04 \x01(\tR\x03url\x12$\n" +
+	"\x05score\x18\x05 \x01(\v2\x0e.grpcapi.ScoreR\x05score\"9\n" +
+	"\x14WatchBackendsRequest\x12!\n" +
+	"\fservice_name\x18\x01 \x01(\tR\vserviceName\"y\n" +
+	"\x0eBackendMetrics\x12\x1b\n" +
+	"\tcpu_usage\x18\x01 \x01(\x01R\bcpuUsage\x12!\n" +
+	"\fmemory_usage\x18\x02 \x01(\x01R\vmemoryUsage\x12'\n" +
+	"\x0fnetwork_traffic\x18\x03 \x01(\x01R\x0enetworkTraffic\"\x8c\x02\n" +
+	"\rBackendStatus\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04host\x18\x02 \x01(\tR\x04host\x12\x12\n" +
+	"\x04port\x18\x03 \x01(\x05R\x04port\x12\x10\n" +
+	"\x03url\x18\x04 \x01(\tR\x03url\x12\x16\n" +
+	"\x06weight\x18\x05 \x01(\x05R\x06weight\x121\n" +
+	"\ametrics\x18\x06 \x01(\v2\x17.grpcapi.BackendMetricsR\ametrics\x12\x14\n" +
+	"\x05score\x18\a \x01(\x01R\x05score\x12\x18\n" +
+	"\ahealthy\x18\b \x01(\bR\ahealthy\x12\x18\n" +
+	"\aejected\x18\t \x01(\bR\aejected\x12\x18\n" +
+	"\acircuit\x18\n" +
+	" \x01(\tR\acircuit\"g\n" +
+	"\x0eBackendsUpdate\x12!\n" +
+	"\fservice_name\x18\x01 \x01(\tR\vserviceName\x122\n" +
+	"\bbackends\x18\x02 \x03(\v2\x16.grpcapi.BackendStatusR\bbackends2\xa1\x01\n" +
 	"\x0eSidecarService\x12D\n" +
-	"\fRouteRequest\x12\x1c.grpcapi.RouteRequestRequest\x1a\x16.grpcapi.RouteResponseB\rZ\vpkg/grpcapib\x06proto3"
+	"\fRouteRequest\x12\x1c.grpcapi.RouteRequestRequest\x1a\x16.grpcapi.RouteResponse\x12I\n" +
+	"\rWatchBackends\x12\x1d.grpcapi.WatchBackendsRequest\x1a\x17.grpcapi.BackendsUpdate0\x01B\rZ\vpkg/grpcapib\x06proto3"
 
 var (
 	file_control_proto_rawDescOnce sync.Once
@@ -133,19 +873,41 @@ func file_control_proto_rawDescGZIP() []byte {
 	return file_control_proto_rawDescData
 }
 
-var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_control_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_control_proto_goTypes = []any{
-	(*RouteRequestRequest)(nil), // 0: grpcapi.RouteRequestRequest
-	(*RouteResponse)(nil),       // 1: grpcapi.RouteResponse
+	(*RouteRequestRequest)(nil),  // 0: grpcapi.RouteRequestRequest
+	(*RouteResponse)(nil),        // 1: grpcapi.RouteResponse
+	(*Attempt)(nil),              // 2: grpcapi.Attempt
+	(*Score)(nil),                // 3: grpcapi.Score
+	(*RankedBackend)(nil),        // 4: grpcapi.RankedBackend
+	(*WatchBackendsRequest)(nil), // 5: grpcapi.WatchBackendsRequest
+	(*BackendMetrics)(nil),       // 6: grpcapi.BackendMetrics
+	(*BackendStatus)(nil),        // 7: grpcapi.BackendStatus
+	(*BackendsUpdate)(nil),       // 8: grpcapi.BackendsUpdate
+	nil,                          // 9: grpcapi.RouteRequestRequest.HeadersEntry
+	nil,                          // 10: grpcapi.RouteResponse.HeadersEntry
+	(*durationpb.Duration)(nil),  // 11: google.protobuf.Duration
 }
 var file_control_proto_depIdxs = []int32{
-	0, // 0: grpcapi.SidecarService.RouteRequest:input_type -> grpcapi.RouteRequestRequest
-	1, // 1: grpcapi.SidecarService.RouteRequest:output_type -> grpcapi.RouteResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	9,  // 0: grpcapi.RouteRequestRequest.headers:type_name -> grpcapi.RouteRequestRequest.HeadersEntry
+	3,  // 1: grpcapi.RouteResponse.score:type_name -> grpcapi.Score
+	4,  // 2: grpcapi.RouteResponse.fallbacks:type_name -> grpcapi.RankedBackend
+	11, // 3: grpcapi.RouteResponse.latency:type_name -> google.protobuf.Duration
+	10, // 4: grpcapi.RouteResponse.headers:type_name -> grpcapi.RouteResponse.HeadersEntry
+	2,  // 5: grpcapi.RouteResponse.attempts:type_name -> grpcapi.Attempt
+	11, // 6: grpcapi.Attempt.latency:type_name -> google.protobuf.Duration
+	3,  // 7: grpcapi.RankedBackend.score:type_name -> grpcapi.Score
+	6,  // 8: grpcapi.BackendStatus.metrics:type_name -> grpcapi.BackendMetrics
+	7,  // 9: grpcapi.BackendsUpdate.backends:type_name -> grpcapi.BackendStatus
+	0,  // 10: grpcapi.SidecarService.RouteRequest:input_type -> grpcapi.RouteRequestRequest
+	5,  // 11: grpcapi.SidecarService.WatchBackends:input_type -> grpcapi.WatchBackendsRequest
+	1,  // 12: grpcapi.SidecarService.RouteRequest:output_type -> grpcapi.RouteResponse
+	8,  // 13: grpcapi.SidecarService.WatchBackends:output_type -> grpcapi.BackendsUpdate
+	12, // [12:14] is the sub-list for method output_type
+	10, // [10:12] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_control_proto_init() }
@@ -159,7 +921,7 @@ func file_control_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_control_proto_rawDesc), len(file_control_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,7 +19,8 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	SidecarService_RouteRequest_FullMethodName = "/grpcapi.SidecarService/RouteRequest"
+	SidecarService_RouteRequest_FullMethodName  = "/grpcapi.SidecarService/RouteRequest"
+	SidecarService_WatchBackends_FullMethodName = "/grpcapi.SidecarService/WatchBackends"
 )
 
 // SidecarServiceClient is the client API for SidecarService service.
@@ -27,6 +28,9 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type SidecarServiceClient interface {
 	RouteRequest(ctx context.Context, in *RouteRequestRequest, opts ...grpc.CallOption) (*RouteResponse, error)
+	// WatchBackends sends the backends of a service, with their latest metrics,
+	// scores and health, immediately and then every time any of them changes.
+	WatchBackends(ctx context.Context, in *WatchBackendsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BackendsUpdate], error)
 }
 
 type sidecarServiceClient struct {
@@ -47,11 +51,33 @@ func (c *sidecarServiceClient) RouteRequest(ctx context.Context, in *RouteReques
 	return out, nil
 }
 
+func (c *sidecarServiceClient) WatchBackends(ctx context.Context, in *WatchBackendsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BackendsUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SidecarService_ServiceDesc.Streams[0], SidecarService_WatchBackends_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchBackendsRequest, BackendsUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SidecarService_WatchBackendsClient = grpc.ServerStreamingClient[BackendsUpdate]
+
 // SidecarServiceServer is the server API for SidecarService service.
 // All implementations must embed UnimplementedSidecarServiceServer
 // for forward compatibility.
 type SidecarServiceServer interface {
 	RouteRequest(context.Context, *RouteRequestRequest) (*RouteResponse, error)
+	// WatchBackends sends the backends of a service, with their latest metrics,
+	// scores and health, immediately and then every time any of them changes.
+	WatchBackends(*WatchBackendsRequest, grpc.ServerStreamingServer[BackendsUpdate]) error
 	mustEmbedUnimplementedSidecarServiceServer()
 }
 
@@ -65,6 +91,9 @@ type UnimplementedSidecarServiceServer struct{}
 func (UnimplementedSidecarServiceServer) RouteRequest(context.Context, *RouteRequestRequest) (*RouteResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RouteRequest not implemented")
 }
+func (UnimplementedSidecarServiceServer) WatchBackends(*WatchBackendsRequest, grpc.ServerStreamingServer[BackendsUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchBackends not implemented")
+}
 func (UnimplementedSidecarServiceServer) mustEmbedUnimplementedSidecarServiceServer() {}
 func (UnimplementedSidecarServiceServer) testEmbeddedByValue()                        {}
 
@@ -104,6 +133,17 @@ func _SidecarService_RouteRequest_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SidecarService_WatchBackends_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchBackendsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SidecarServiceServer).WatchBackends(m, &grpc.GenericServerStream[WatchBackendsRequest, BackendsUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SidecarService_WatchBackendsServer = grpc.ServerStreamingServer[BackendsUpdate]
+
 // SidecarService_ServiceDesc is the grpc.ServiceDesc for SidecarService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -116,6 +156,12 @@ var SidecarService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _SidecarService_RouteRequest_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchBackends",
+			Handler:       _SidecarService_WatchBackends_Handler,
+			ServerStreams: true,
+		},
+	},
 	Metadata: "control.proto",
 }
@@ -0,0 +1,134 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"try/pkg/config"
+	"try/pkg/discovery"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Checker checks one backend once; a nil error means healthy.
+type Checker interface {
+	Check(ctx context.Context, b discovery.Backend) error
+}
+
+func NewChecker(cfg config.HealthCheck) (Checker, error) {
+	switch cfg.Type {
+	case config.HealthCheckHTTP:
+		return &HTTPChecker{Path: cfg.Path, Client: http.DefaultClient}, nil
+	case config.HealthCheckTCP:
+		return TCPChecker{}, nil
+	case config.HealthCheckGRPC:
+		return &GRPCChecker{Service: cfg.GRPCService}, nil
+	}
+	return nil, fmt.Errorf("unknown health check type %q", cfg.Type)
+}
+
+type HTTPChecker struct {
+	Path   string
+	Client *http.Client
+}
+
+func (c *HTTPChecker) Check(ctx context.Context, b discovery.Backend) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.URL()+c.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("GET %s: %s", c.Path, resp.Status)
+	}
+	return nil
+}
+
+type TCPChecker struct{}
+
+func (TCPChecker) Check(ctx context.Context, b discovery.Backend) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(b.Address, strconv.Itoa(b.Port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// GRPCChecker uses the standard grpc.health.v1 protocol. It keeps a
+// connection per backend between checks.
+type GRPCChecker struct {
+	Service string
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func (c *GRPCChecker) Check(ctx context.Context, b discovery.Backend) error {
+	conn, err := c.conn(net.JoinHostPort(b.Address, strconv.Itoa(b.Port)))
+	if err != nil {
+		return err
+	}
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: c.Service})
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("health status %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *GRPCChecker) conn(target string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if conn, ok := c.conns[target]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	if c.conns == nil {
+		c.conns = map[string]*grpc.ClientConn{}
+	}
+	c.conns[target] = conn
+	return conn, nil
+}
+
+// Retain closes the connections of backends not in backends, which are no
+// longer checked.
+func (c *GRPCChecker) Retain(backends []discovery.Backend) {
+	keep := map[string]bool{}
+	for _, b := range backends {
+		keep[net.JoinHostPort(b.Address, strconv.Itoa(b.Port))] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, conn := range c.conns {
+		if !keep[target] {
+			conn.Close()
+			delete(c.conns, target)
+		}
+	}
+}
+
+// Close releases every connection.
+func (c *GRPCChecker) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, conn := range c.conns {
+		conn.Close()
+		delete(c.conns, target)
+	}
+}
@@ -0,0 +1,147 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"try/pkg/config"
+	"try/pkg/discovery"
+
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// backendAt returns a backend for a host:port address.
+func backendAt(t *testing.T, name, addr string) discovery.Backend {
+	t.Helper()
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return discovery.Backend{Name: name, Address: host, Port: p}
+}
+
+// closedAddr returns a loopback address nothing listens on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+	return lis.Addr().String()
+}
+
+func check(c Checker, b discovery.Backend) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return c.Check(ctx, b)
+}
+
+func TestHTTPChecker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	b := backendAt(t, "cart-1", srv.Listener.Addr().String())
+
+	if err := check(&HTTPChecker{Path: "/healthz", Client: http.DefaultClient}, b); err != nil {
+		t.Errorf("healthy backend: %v", err)
+	}
+	if err := check(&HTTPChecker{Path: "/", Client: http.DefaultClient}, b); err == nil {
+		t.Error("no error for a 503")
+	}
+	if err := check(&HTTPChecker{Path: "/healthz", Client: http.DefaultClient}, backendAt(t, "cart-2", closedAddr(t))); err == nil {
+		t.Error("no error for a closed port")
+	}
+}
+
+func TestTCPChecker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	if err := check(TCPChecker{}, backendAt(t, "cart-1", lis.Addr().String())); err != nil {
+		t.Errorf("listening backend: %v", err)
+	}
+	if err := check(TCPChecker{}, backendAt(t, "cart-2", closedAddr(t))); err == nil {
+		t.Error("no error for a closed port")
+	}
+}
+
+func TestGRPCChecker(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := grpchealth.NewServer()
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, status)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	b := backendAt(t, "cart-1", lis.Addr().String())
+
+	c := &GRPCChecker{Service: "shop.Cart"}
+	defer c.Close()
+	if err := check(c, b); err == nil {
+		t.Error("no error for an unknown service")
+	}
+	status.SetServingStatus("shop.Cart", healthpb.HealthCheckResponse_SERVING)
+	if err := check(c, b); err != nil {
+		t.Errorf("serving backend: %v", err)
+	}
+	status.SetServingStatus("shop.Cart", healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := check(c, b); err == nil {
+		t.Error("no error for NOT_SERVING")
+	}
+}
+
+func TestGRPCCheckerClosesRemovedBackends(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, grpchealth.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	// Two backends on the same server, told apart by address.
+	one := backendAt(t, "cart-1", lis.Addr().String())
+	two := one
+	two.Name, two.Address = "cart-2", "localhost"
+
+	c := &GRPCChecker{}
+	source := &discovery.BackendSet{}
+	source.Set([]discovery.Backend{one, two})
+	m := NewMonitor("cart", source, c, config.HealthCheck{Timeout: 2 * time.Second, HealthyThreshold: 1, UnhealthyThreshold: 1})
+	m.CheckAll(context.Background())
+	if len(c.conns) != 2 {
+		t.Fatalf("%d connections, want 2", len(c.conns))
+	}
+	kept := c.conns[lis.Addr().String()]
+
+	source.Set([]discovery.Backend{one})
+	m.CheckAll(context.Background())
+	if len(c.conns) != 1 || c.conns[lis.Addr().String()] != kept {
+		t.Errorf("connections after cart-2 was removed: %v", c.conns)
+	}
+	c.Close()
+	if len(c.conns) != 0 {
+		t.Errorf("%d connections left after Close", len(c.conns))
+	}
+}
@@ -0,0 +1,156 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"try/pkg/config"
+	"try/pkg/discovery"
+)
+
+// Status is the health of one backend as last decided by a Monitor.
+type Status struct {
+	Healthy   bool      `json:"healthy"`
+	LastError string    `json:"last_error,omitempty"`
+	LastCheck time.Time `json:"last_check"`
+	Since     time.Time `json:"since"`
+}
+
+type state struct {
+	Status
+	successes int
+	failures  int
+}
+
+// Monitor checks the backends of one service on an interval and tracks
+// whether each is healthy. Backends start out healthy and change state only
+// after HealthyThreshold consecutive successes or UnhealthyThreshold
+// consecutive failures.
+type Monitor struct {
+	service string
+	source  discovery.Source
+	checker Checker
+	cfg     config.HealthCheck
+	// OnChange, if set, is called after any backend changes state.
+	OnChange func()
+
+	mu     sync.RWMutex
+	states map[string]*state
+}
+
+func NewMonitor(service string, source discovery.Source, checker Checker, cfg config.HealthCheck) *Monitor {
+	return &Monitor{
+		service: service,
+		source:  source,
+		checker: checker,
+		cfg:     cfg,
+		states:  map[string]*state{},
+	}
+}
+
+// Run checks every backend now and then on each interval until stop is
+// closed.
+func (m *Monitor) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	if c, ok := m.checker.(interface{ Close() }); ok {
+		defer c.Close()
+	}
+	for {
+		m.CheckAll(context.Background())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll runs one round of checks, concurrently across backends.
+func (m *Monitor) CheckAll(ctx context.Context) {
+	backends := m.source.Backends()
+	results := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		wg.Add(1)
+		go func(i int, b discovery.Backend) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+			defer cancel()
+			results[i] = m.checker.Check(ctx, b)
+		}(i, b)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	changed := false
+	m.mu.Lock()
+	present := map[string]bool{}
+	for i, b := range backends {
+		present[b.Name] = true
+		if m.record(b.Name, results[i], now) {
+			changed = true
+		}
+	}
+	for name := range m.states {
+		if !present[name] {
+			delete(m.states, name)
+		}
+	}
+	m.mu.Unlock()
+	if c, ok := m.checker.(interface{ Retain([]discovery.Backend) }); ok {
+		c.Retain(backends)
+	}
+
+	if changed && m.OnChange != nil {
+		m.OnChange()
+	}
+}
+
+// record applies one check result and reports whether the backend changed
+// state. m.mu must be held.
+func (m *Monitor) record(name string, err error, now time.Time) bool {
+	st, ok := m.states[name]
+	if !ok {
+		st = &state{Status: Status{Healthy: true, Since: now}}
+		m.states[name] = st
+	}
+	st.LastCheck = now
+
+	if err == nil {
+		st.LastError = ""
+		st.failures = 0
+		st.successes++
+		if !st.Healthy && st.successes >= m.cfg.HealthyThreshold {
+			st.Healthy = true
+			st.Since = now
+			slog.Info("backend is healthy again", "service", m.service, "backend", name)
+			return true
+		}
+		return false
+	}
+
+	st.LastError = err.Error()
+	st.successes = 0
+	st.failures++
+	if st.Healthy && st.failures >= m.cfg.UnhealthyThreshold {
+		st.Healthy = false
+		st.Since = now
+		slog.Warn("backend is unhealthy", "service", m.service, "backend", name, "failed_checks", st.failures, "error", err)
+		return true
+	}
+	return false
+}
+
+// Status returns the health of a backend. Backends that have not been
+// checked yet are healthy.
+func (m *Monitor) Status(name string) Status {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if st, ok := m.states[name]; ok {
+		return st.Status
+	}
+	return Status{Healthy: true}
+}
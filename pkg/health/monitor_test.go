@@ -0,0 +1,82 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"try/pkg/config"
+	"try/pkg/discovery"
+)
+
+// fakeChecker fails the backends whose name is in down.
+type fakeChecker struct {
+	mu   sync.Mutex
+	down map[string]bool
+}
+
+func (c *fakeChecker) set(name string, down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down[name] = down
+}
+
+func (c *fakeChecker) Check(_ context.Context, b discovery.Backend) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down[b.Name] {
+		return errors.New("down")
+	}
+	return nil
+}
+
+func TestMonitorThresholds(t *testing.T) {
+	source := discovery.Static([]config.Backend{
+		{Name: "cart-1", Address: "127.0.0.1", Port: 1},
+		{Name: "cart-2", Address: "127.0.0.1", Port: 2},
+	})
+	checker := &fakeChecker{down: map[string]bool{}}
+	m := NewMonitor("cart", source, checker, config.HealthCheck{
+		Timeout:            time.Second,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 3,
+	})
+	changes := 0
+	m.OnChange = func() { changes++ }
+
+	if !m.Status("cart-1").Healthy {
+		t.Fatal("unchecked backend is unhealthy")
+	}
+	checker.set("cart-1", true)
+	for i, want := range []bool{true, true, false, false} {
+		m.CheckAll(context.Background())
+		if got := m.Status("cart-1").Healthy; got != want {
+			t.Fatalf("after failed check %d: healthy = %v, want %v", i+1, got, want)
+		}
+	}
+	if st := m.Status("cart-1"); st.LastError != "down" {
+		t.Errorf("last error = %q, want down", st.LastError)
+	}
+
+	// A failure in between starts the count over.
+	checker.set("cart-1", false)
+	m.CheckAll(context.Background())
+	checker.set("cart-1", true)
+	m.CheckAll(context.Background())
+	checker.set("cart-1", false)
+	for i, want := range []bool{false, true} {
+		m.CheckAll(context.Background())
+		if got := m.Status("cart-1").Healthy; got != want {
+			t.Fatalf("after successful check %d: healthy = %v, want %v", i+1, got, want)
+		}
+	}
+
+	if !m.Status("cart-2").Healthy {
+		t.Error("cart-2 is unhealthy")
+	}
+	if changes != 2 {
+		t.Errorf("OnChange called %d times, want 2", changes)
+	}
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+
+	"try/pkg/config"
+)
+
+// New returns a logger that writes records of cfg.Level and above to w in
+// cfg.Format.
+func New(cfg config.Log, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if cfg.Format == config.LogFormatJSON {
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), nil
+}
+
+// Setup makes a logger for cfg writing to stderr the default. The standard
+// log package writes through it too, at info level.
+func Setup(cfg config.Log) error {
+	logger, err := New(cfg, os.Stderr)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// Sampler keeps a random share of a stream of records, between 0 and 1.
+type Sampler float64
+
+func (s Sampler) Sample() bool {
+	return s >= 1 || rand.Float64() < float64(s)
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"try/pkg/discovery"
+)
+
+type BackendMetrics struct {
+	CPUUsage       float64
+	MemoryUsage    float64
+	NetworkTraffic float64
+}
+
+// Source reports the current load of a set of backends in one go, keyed by
+// backend name. Backends with no data are left out of the result. CPUUsage
+// is a percentage of one core, MemoryUsage a percentage of nodeMemoryMiB and
+// NetworkTraffic is in bytes per second, whatever the underlying API.
+type Source interface {
+	Metrics(ctx context.Context, backends []discovery.Backend) (map[string]BackendMetrics, error)
+}
+
+// nodeMemoryMiB is the memory that MemoryUsage is expressed against.
+const nodeMemoryMiB = 33560.0
+
+func memoryPercent(bytes float64) float64 {
+	return (bytes / (1024 * 1024) / nodeMemoryMiB) * 100
+}
+
+// podMatcher maps pod names back to the backend whose PodSelector matches
+// them. Selectors are anchored like Prometheus' =~.
+type podMatcher struct {
+	names     []string
+	selectors []string
+	res       []*regexp.Regexp
+}
+
+func newPodMatcher(backends []discovery.Backend) (*podMatcher, error) {
+	m := &podMatcher{}
+	for _, b := range backends {
+		re, err := regexp.Compile("^(?:" + b.PodSelector + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: invalid pod selector %q: %w", b.Name, b.PodSelector, err)
+		}
+		m.names = append(m.names, b.Name)
+		m.selectors = append(m.selectors, "(?:"+b.PodSelector+")")
+		m.res = append(m.res, re)
+	}
+	return m, nil
+}
+
+// regex returns one selector matching the pods of every backend.
+func (m *podMatcher) regex() string {
+	return strings.Join(m.selectors, "|")
+}
+
+func (m *podMatcher) backend(pod string) (string, bool) {
+	for i, re := range m.res {
+		if re.MatchString(pod) {
+			return m.names[i], true
+		}
+	}
+	return "", false
+}
+
+// average folds per-pod values into per-backend values, averaging over the
+// pods of a backend so that a backend with more replicas doesn't look busier.
+func (m *podMatcher) average(perPod map[string]float64) map[string]float64 {
+	sums := map[string]float64{}
+	counts := map[string]int{}
+	for pod, v := range perPod {
+		name, ok := m.backend(pod)
+		if !ok {
+			continue
+		}
+		sums[name] += v
+		counts[name]++
+	}
+	for name := range sums {
+		sums[name] /= float64(counts[name])
+	}
+	return sums
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"try/pkg/discovery"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// MetricsServer reads PodMetrics from the metrics.k8s.io API, for clusters
+// that run metrics-server but not Prometheus. It has no network counters, so
+// NetworkTraffic is always 0.
+type MetricsServer struct {
+	client    metricsclient.Interface
+	namespace string
+}
+
+func NewMetricsServer(client metricsclient.Interface, namespace string) *MetricsServer {
+	return &MetricsServer{client: client, namespace: namespace}
+}
+
+// Metrics lists the namespace's PodMetrics once, sums the usage of each
+// pod's containers and averages it over the pods of each backend.
+func (m *MetricsServer) Metrics(ctx context.Context, backends []discovery.Backend) (map[string]BackendMetrics, error) {
+	if len(backends) == 0 {
+		return nil, nil
+	}
+	matcher, err := newPodMatcher(backends)
+	if err != nil {
+		return nil, err
+	}
+	list, err := m.client.MetricsV1beta1().PodMetricses(m.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing pod metrics: %w", err)
+	}
+
+	cores := map[string]float64{}
+	bytes := map[string]float64{}
+	for _, pm := range list.Items {
+		for _, c := range pm.Containers {
+			cores[pm.Name] += c.Usage.Cpu().AsApproximateFloat64()
+			bytes[pm.Name] += c.Usage.Memory().AsApproximateFloat64()
+		}
+	}
+	cpuByBackend := matcher.average(cores)
+	memByBackend := matcher.average(bytes)
+
+	result := map[string]BackendMetrics{}
+	for _, b := range backends {
+		if _, ok := cpuByBackend[b.Name]; !ok {
+			continue
+		}
+		result[b.Name] = BackendMetrics{
+			CPUUsage:    cpuByBackend[b.Name] * 100,
+			MemoryUsage: memoryPercent(memByBackend[b.Name]),
+		}
+	}
+	return result, nil
+}
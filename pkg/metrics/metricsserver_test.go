@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"try/pkg/discovery"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	"k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// podMetrics returns the metrics of a pod whose containers use the given
+// CPU and memory quantities, such as "250m" and "64Mi".
+func podMetrics(namespace, pod string, usage ...[2]string) *metricsv1beta1.PodMetrics {
+	pm := &metricsv1beta1.PodMetrics{ObjectMeta: metav1.ObjectMeta{Name: pod, Namespace: namespace}}
+	for _, u := range usage {
+		pm.Containers = append(pm.Containers, metricsv1beta1.ContainerMetrics{
+			Name: "c",
+			Usage: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(u[0]),
+				corev1.ResourceMemory: resource.MustParse(u[1]),
+			},
+		})
+	}
+	return pm
+}
+
+// fakeMetricsClient returns a clientset serving the given PodMetrics. The
+// generated fake files them under "podmetricses" but lists "pods", so they
+// are added to its tracker directly.
+func fakeMetricsClient(t *testing.T, pods ...*metricsv1beta1.PodMetrics) *fake.Clientset {
+	t.Helper()
+	client := fake.NewSimpleClientset()
+	gvr := metricsv1beta1.SchemeGroupVersion.WithResource("pods")
+	for _, pm := range pods {
+		if err := client.Tracker().Create(gvr, pm, pm.Namespace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return client
+}
+
+func TestMetricsServerMetrics(t *testing.T) {
+	client := fakeMetricsClient(t,
+		// Two containers, summed per pod.
+		podMetrics("shop", "cart-a-1", [2]string{"100m", "64Mi"}, [2]string{"100m", "64Mi"}),
+		podMetrics("shop", "cart-a-2", [2]string{"400m", "256Mi"}),
+		podMetrics("shop", "cart-b-1", [2]string{"50m", "32Mi"}),
+		podMetrics("shop", "orders-1", [2]string{"900m", "1Gi"}),
+		// Another namespace.
+		podMetrics("other", "cart-b-2", [2]string{"2", "1Gi"}),
+	)
+	backends := []discovery.Backend{
+		{Name: "cart-a", PodSelector: "cart-a-.*"},
+		{Name: "cart-b", PodSelector: "cart-b-.*"},
+		{Name: "cart-c", PodSelector: "cart-c-.*"},
+	}
+
+	got, err := NewMetricsServer(client, "shop").Metrics(context.Background(), backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]BackendMetrics{
+		"cart-a": {CPUUsage: 30, MemoryUsage: memoryPercent(192 * 1024 * 1024)},
+		"cart-b": {CPUUsage: 5, MemoryUsage: memoryPercent(32 * 1024 * 1024)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for name, w := range want {
+		g, ok := got[name]
+		if !ok || !approx(g.CPUUsage, w.CPUUsage) || !approx(g.MemoryUsage, w.MemoryUsage) || g.NetworkTraffic != 0 {
+			t.Errorf("%s = %+v, want %+v", name, g, w)
+		}
+	}
+}
+
+func TestMetricsServerError(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("list", "pods", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("metrics API unavailable")
+	})
+	backends := []discovery.Backend{{Name: "cart-a", PodSelector: "cart-a-.*"}}
+	if _, err := NewMetricsServer(client, "shop").Metrics(context.Background(), backends); err == nil {
+		t.Fatal("no error when listing pod metrics fails")
+	}
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"try/pkg/discovery"
+)
+
+// Prometheus reads cAdvisor container metrics through the Prometheus HTTP
+// API. It issues one query per metric for all backends, grouped by pod.
+type Prometheus struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewPrometheus(url string) *Prometheus {
+	return &Prometheus{URL: url, Client: http.DefaultClient}
+}
+
+func (p *Prometheus) Metrics(ctx context.Context, backends []discovery.Backend) (map[string]BackendMetrics, error) {
+	if len(backends) == 0 {
+		return nil, nil
+	}
+	matcher, err := newPodMatcher(backends)
+	if err != nil {
+		return nil, err
+	}
+	podRegex := matcher.regex()
+
+	cpu, err := p.queryByPod(ctx, fmt.Sprintf(`sum by (pod) (rate(container_cpu_usage_seconds_total{container!="",pod=~"%s"}[5m]))`, podRegex))
+	if err != nil {
+		return nil, err
+	}
+	mem, err := p.queryByPod(ctx, fmt.Sprintf(`sum by (pod) (container_memory_usage_bytes{container!="",pod=~"%s"})`, podRegex))
+	if err != nil {
+		return nil, err
+	}
+	netRx, err := p.queryByPod(ctx, fmt.Sprintf(`sum by (pod) (rate(container_network_receive_bytes_total{pod=~"%s"}[5m]))`, podRegex))
+	if err != nil {
+		return nil, err
+	}
+	netTx, err := p.queryByPod(ctx, fmt.Sprintf(`sum by (pod) (rate(container_network_transmit_bytes_total{pod=~"%s"}[5m]))`, podRegex))
+	if err != nil {
+		return nil, err
+	}
+
+	cpuByBackend := matcher.average(cpu)
+	memByBackend := matcher.average(mem)
+	rxByBackend := matcher.average(netRx)
+	txByBackend := matcher.average(netTx)
+
+	result := map[string]BackendMetrics{}
+	for _, b := range backends {
+		_, hasCPU := cpuByBackend[b.Name]
+		_, hasMem := memByBackend[b.Name]
+		_, hasRx := rxByBackend[b.Name]
+		_, hasTx := txByBackend[b.Name]
+		if !hasCPU && !hasMem && !hasRx && !hasTx {
+			continue
+		}
+		result[b.Name] = BackendMetrics{
+			CPUUsage:       cpuByBackend[b.Name] * 100,
+			MemoryUsage:    memoryPercent(memByBackend[b.Name]),
+			NetworkTraffic: rxByBackend[b.Name] + txByBackend[b.Name],
+		}
+	}
+	return result, nil
+}
+
+// queryByPod runs an instant query and returns the value of every series,
+// keyed by its pod label.
+func (p *Prometheus) queryByPod(ctx context.Context, query string) (map[string]float64, error) {
+	u := p.URL + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying Prometheus: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading Prometheus response: %w", err)
+	}
+	var result struct {
+		Status string `json:"status"`
+		Error  string `json:"error"`
+		Data   struct {
+			Result []struct {
+				Metric map[string]string `json:"metric"`
+				Value  [2]interface{}    `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("decoding Prometheus response (%s): %w", resp.Status, err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("Prometheus query failed: %s", result.Error)
+	}
+
+	values := map[string]float64{}
+	for _, series := range result.Data.Result {
+		pod := series.Metric["pod"]
+		valueStr, _ := series.Value[1].(string)
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if pod == "" || err != nil {
+			continue
+		}
+		values[pod] = value
+	}
+	return values, nil
+}
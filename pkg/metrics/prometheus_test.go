@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"try/pkg/discovery"
+)
+
+type series struct {
+	pod, value string
+}
+
+// fakePrometheus answers instant queries with the series listed for the
+// metric named in the query.
+func fakePrometheus(t *testing.T, byMetric map[string][]series) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query().Get("query")
+		var result []any
+		for metric, ss := range byMetric {
+			if !strings.Contains(query, metric+"{") {
+				continue
+			}
+			for _, s := range ss {
+				result = append(result, map[string]any{
+					"metric": map[string]string{"pod": s.pod},
+					"value":  []any{1700000000.0, s.value},
+				})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"status": "success",
+			"data":   map[string]any{"resultType": "vector", "result": result},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	srv := fakePrometheus(t, map[string][]series{
+		"container_cpu_usage_seconds_total": {
+			{"cart-a-1", "0.2"},
+			{"cart-a-2", "0.4"},
+			{"cart-b-1", "0.5"},
+			// Not a pod of any backend.
+			{"orders-1", "0.9"},
+			// Left out, not counted as 0.
+			{"cart-b-2", "not-a-number"},
+		},
+		"container_memory_usage_bytes": {
+			{"cart-a-1", "1048576"},
+			{"cart-a-2", "3145728"},
+		},
+		"container_network_receive_bytes_total": {
+			{"cart-a-1", "100"},
+			{"cart-a-2", "300"},
+			{"cart-b-1", "50"},
+		},
+		"container_network_transmit_bytes_total": {
+			{"cart-a-1", "10"},
+			{"cart-a-2", "30"},
+		},
+	})
+	backends := []discovery.Backend{
+		{Name: "cart-a", PodSelector: "cart-a-.*"},
+		{Name: "cart-b", PodSelector: "cart-b-.*"},
+		// No pod in any result.
+		{Name: "cart-c", PodSelector: "cart-c-.*"},
+	}
+
+	got, err := NewPrometheus(srv.URL).Metrics(context.Background(), backends)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got["cart-c"]; ok {
+		t.Errorf("cart-c has metrics %+v, want none", got["cart-c"])
+	}
+	if len(got) != 2 {
+		t.Fatalf("got metrics for %d backends, want 2: %+v", len(got), got)
+	}
+
+	a := got["cart-a"]
+	if !approx(a.CPUUsage, 30) {
+		t.Errorf("cart-a CPU = %v, want the pods' average of 30", a.CPUUsage)
+	}
+	if want := memoryPercent(2 * 1048576); !approx(a.MemoryUsage, want) {
+		t.Errorf("cart-a memory = %v, want %v", a.MemoryUsage, want)
+	}
+	if !approx(a.NetworkTraffic, 220) {
+		t.Errorf("cart-a network = %v, want 200 received + 20 sent", a.NetworkTraffic)
+	}
+
+	b := got["cart-b"]
+	if !approx(b.CPUUsage, 50) {
+		t.Errorf("cart-b CPU = %v, want 50 from its one parsable series", b.CPUUsage)
+	}
+	if b.MemoryUsage != 0 || !approx(b.NetworkTraffic, 50) {
+		t.Errorf("cart-b = %+v, want no memory and 50 network", b)
+	}
+}
+
+func TestPrometheusErrors(t *testing.T) {
+	backends := []discovery.Backend{{Name: "cart-a", PodSelector: "cart-a-.*"}}
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{
+			name: "error status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+			},
+			wantErr: "Prometheus query failed: parse error",
+		},
+		{
+			name: "not JSON",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "upstream unavailable", http.StatusBadGateway)
+			},
+			wantErr: "decoding Prometheus response (502 Bad Gateway)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			_, err := NewPrometheus(srv.URL).Metrics(context.Background(), backends)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		if _, err := NewPrometheus(srv.URL).Metrics(context.Background(), backends); err == nil {
+			t.Fatal("no error from an unreachable Prometheus")
+		}
+	})
+
+	t.Run("invalid pod selector", func(t *testing.T) {
+		bad := []discovery.Backend{{Name: "cart-a", PodSelector: "cart-(a"}}
+		if _, err := NewPrometheus("http://unused").Metrics(context.Background(), bad); err == nil {
+			t.Fatal("no error for an invalid pod selector")
+		}
+	})
+}
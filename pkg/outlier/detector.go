@@ -0,0 +1,336 @@
+package outlier
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"try/pkg/config"
+	"try/pkg/discovery"
+)
+
+// maxLatencySamples bounds the latencies kept per backend and interval.
+const maxLatencySamples = 1000
+
+// Status is the outlier state of one backend.
+type Status struct {
+	Ejected      bool      `json:"ejected"`
+	EjectedUntil time.Time `json:"ejected_until,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+	// Ejections is the back-off multiplier: it grows with every ejection and
+	// shrinks for every interval the backend is not ejected.
+	Ejections   int     `json:"ejections"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// window counts the requests to a backend in one interval.
+type window struct {
+	requests  int
+	failures  int
+	latencies []time.Duration
+}
+
+type state struct {
+	ejectedUntil time.Time
+	reason       string
+	ejections    int
+	consecutive  int
+	cur, last    window
+}
+
+func (st *state) ejected(now time.Time) bool {
+	return now.Before(st.ejectedUntil)
+}
+
+// Detector ejects backends of one service from the pool based on the
+// outcome of the requests sent to them: right away after ConsecutiveErrors
+// failures in a row, and on each interval if their success rate or latency
+// is an outlier among their peers. Ejections last BaseEjectionTime, doubled
+// for each recent ejection, and never take more than MaxEjectionPercent of
+// the backends or the last one out of the pool.
+type Detector struct {
+	service string
+	source  discovery.Source
+	cfg     config.OutlierDetection
+	// OnChange, if set, is called after a backend is ejected or returned.
+	OnChange func()
+
+	mu     sync.Mutex
+	states map[string]*state
+}
+
+func NewDetector(service string, source discovery.Source, cfg config.OutlierDetection) *Detector {
+	return &Detector{
+		service: service,
+		source:  source,
+		cfg:     cfg,
+		states:  map[string]*state{},
+	}
+}
+
+// Record adds the outcome of one request to a backend. A latency of 0 adds
+// no latency sample, for requests such as streams whose duration says
+// nothing about the backend.
+func (d *Detector) Record(name string, failed bool, latency time.Duration) {
+	now := time.Now()
+	d.mu.Lock()
+	st, ok := d.states[name]
+	if !ok {
+		st = &state{}
+		d.states[name] = st
+	}
+	st.cur.requests++
+	if failed {
+		st.cur.failures++
+		st.consecutive++
+	} else {
+		st.consecutive = 0
+	}
+	if latency > 0 && len(st.cur.latencies) < maxLatencySamples {
+		st.cur.latencies = append(st.cur.latencies, latency)
+	}
+	changed := false
+	if st.consecutive >= d.cfg.ConsecutiveErrors && !st.ejected(now) {
+		changed = d.eject(name, st, now, fmt.Sprintf("%d consecutive errors", st.consecutive))
+	}
+	d.mu.Unlock()
+
+	if changed && d.OnChange != nil {
+		d.OnChange()
+	}
+}
+
+// Run analyzes the backends on each interval until stop is closed.
+func (d *Detector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			d.Analyze(now)
+		}
+	}
+}
+
+// Analyze ends an interval: it returns backends whose ejection has expired
+// and ejects success rate and latency outliers among the rest.
+func (d *Detector) Analyze(now time.Time) {
+	changed := false
+	d.mu.Lock()
+	present := map[string]bool{}
+	for _, b := range d.source.Backends() {
+		present[b.Name] = true
+	}
+	for name, st := range d.states {
+		if !present[name] {
+			delete(d.states, name)
+			continue
+		}
+		switch {
+		case st.ejected(now):
+		case !st.ejectedUntil.IsZero():
+			st.ejectedUntil = time.Time{}
+			st.reason = ""
+			slog.Info("backend returned to the pool", "service", d.service, "backend", name)
+			changed = true
+		case st.ejections > 0:
+			st.ejections--
+		}
+	}
+
+	if d.ejectSuccessRateOutliers(now) {
+		changed = true
+	}
+	if d.ejectLatencyOutliers(now) {
+		changed = true
+	}
+
+	for _, st := range d.states {
+		st.last = st.cur
+		st.cur = window{}
+	}
+	d.mu.Unlock()
+
+	if changed && d.OnChange != nil {
+		d.OnChange()
+	}
+}
+
+// ejectSuccessRateOutliers ejects backends whose success rate in the
+// interval is more than SuccessRateStdevFactor standard deviations below the
+// mean. d.mu must be held.
+func (d *Detector) ejectSuccessRateOutliers(now time.Time) bool {
+	rates := map[string]float64{}
+	for name, st := range d.states {
+		if !st.ejected(now) && st.cur.requests >= d.cfg.MinRequests {
+			rates[name] = 1 - float64(st.cur.failures)/float64(st.cur.requests)
+		}
+	}
+	if len(rates) < d.cfg.MinHosts {
+		return false
+	}
+
+	var mean, variance float64
+	for _, r := range rates {
+		mean += r
+	}
+	mean /= float64(len(rates))
+	for _, r := range rates {
+		variance += (r - mean) * (r - mean)
+	}
+	stdev := math.Sqrt(variance / float64(len(rates)))
+	threshold := mean - d.cfg.SuccessRateStdevFactor*stdev
+
+	changed := false
+	for _, name := range sortedByValue(rates) {
+		if rates[name] >= threshold {
+			break
+		}
+		reason := fmt.Sprintf("success rate %.1f%% below threshold %.1f%%", 100*rates[name], 100*threshold)
+		if d.eject(name, d.states[name], now, reason) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// ejectLatencyOutliers ejects backends whose LatencyPercentile latency in
+// the interval is more than LatencyFactor times the median of all backends'.
+// d.mu must be held.
+func (d *Detector) ejectLatencyOutliers(now time.Time) bool {
+	latencies := map[string]float64{}
+	for name, st := range d.states {
+		if !st.ejected(now) && len(st.cur.latencies) >= d.cfg.MinRequests {
+			latencies[name] = float64(percentile(st.cur.latencies, d.cfg.LatencyPercentile))
+		}
+	}
+	if len(latencies) < d.cfg.MinHosts {
+		return false
+	}
+
+	names := sortedByValue(latencies)
+	median := latencies[names[len(names)/2]]
+	if len(names)%2 == 0 {
+		median = (median + latencies[names[len(names)/2-1]]) / 2
+	}
+	threshold := d.cfg.LatencyFactor * median
+
+	changed := false
+	for i := len(names) - 1; i >= 0 && latencies[names[i]] > threshold; i-- {
+		name := names[i]
+		reason := fmt.Sprintf("p%g latency %v above threshold %v", d.cfg.LatencyPercentile,
+			time.Duration(latencies[name]).Round(time.Millisecond), time.Duration(threshold).Round(time.Millisecond))
+		if d.eject(name, d.states[name], now, reason) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// eject takes a backend out of the pool unless that would eject too many.
+// d.mu must be held.
+func (d *Detector) eject(name string, st *state, now time.Time, reason string) bool {
+	total := len(d.source.Backends())
+	ejected := 0
+	for _, other := range d.states {
+		if other.ejected(now) {
+			ejected++
+		}
+	}
+	if ejected+1 >= total || (ejected+1)*100 > total*d.cfg.MaxEjectionPercent {
+		slog.Warn("not ejecting backend: too many are ejected already", "service", d.service, "backend", name,
+			"reason", reason, "ejected", ejected, "backends", total)
+		return false
+	}
+
+	st.ejections++
+	duration := d.cfg.BaseEjectionTime
+	for i := 1; i < st.ejections && duration < d.cfg.MaxEjectionTime; i++ {
+		duration *= 2
+	}
+	if duration > d.cfg.MaxEjectionTime {
+		duration = d.cfg.MaxEjectionTime
+	}
+	st.ejectedUntil = now.Add(duration)
+	st.reason = reason
+	st.consecutive = 0
+	slog.Warn("ejecting backend", "service", d.service, "backend", name, "duration", duration, "reason", reason)
+	return true
+}
+
+// Ejected reports whether a backend is currently out of the pool.
+func (d *Detector) Ejected(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.states[name]
+	return ok && st.ejected(time.Now())
+}
+
+// FailureRate returns the share of a backend's requests that failed in the
+// current and the last interval, or 0 if it had none.
+func (d *Detector) FailureRate(name string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.states[name]
+	if !ok {
+		return 0
+	}
+	return st.failureRate()
+}
+
+func (st *state) failureRate() float64 {
+	requests := st.cur.requests + st.last.requests
+	if requests == 0 {
+		return 0
+	}
+	return float64(st.cur.failures+st.last.failures) / float64(requests)
+}
+
+// Status returns the outlier state of a backend.
+func (d *Detector) Status(name string) Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	st, ok := d.states[name]
+	if !ok {
+		return Status{}
+	}
+	s := Status{Ejections: st.ejections, FailureRate: st.failureRate()}
+	if st.ejected(time.Now()) {
+		s.Ejected = true
+		s.EjectedUntil = st.ejectedUntil
+		s.Reason = st.reason
+	}
+	return s
+}
+
+// percentile returns the p-th percentile (0-100) of samples by the
+// nearest-rank method.
+func percentile(samples []time.Duration, p float64) time.Duration {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// sortedByValue returns the keys of m in ascending order of their values.
+func sortedByValue(m map[string]float64) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if m[names[i]] != m[names[j]] {
+			return m[names[i]] < m[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,225 @@
+package outlier
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"try/pkg/config"
+	"try/pkg/discovery"
+)
+
+// newTestDetector returns a detector for n backends named b0, b1, ...
+// Outliers are looked for among all of them, and consecutive errors and
+// the success rate and latency rules are off unless cfg turns them on.
+func newTestDetector(n int, cfg config.OutlierDetection) *Detector {
+	var backends []config.Backend
+	for i := 0; i < n; i++ {
+		backends = append(backends, config.Backend{Name: fmt.Sprintf("b%d", i), Address: "127.0.0.1", Port: 8000 + i})
+	}
+	if cfg.ConsecutiveErrors == 0 {
+		cfg.ConsecutiveErrors = 1000
+	}
+	if cfg.BaseEjectionTime == 0 {
+		cfg.BaseEjectionTime = 30 * time.Second
+	}
+	if cfg.MaxEjectionTime == 0 {
+		cfg.MaxEjectionTime = 5 * time.Minute
+	}
+	if cfg.MaxEjectionPercent == 0 {
+		cfg.MaxEjectionPercent = 100
+	}
+	if cfg.MinRequests == 0 {
+		cfg.MinRequests = 1
+	}
+	if cfg.MinHosts == 0 {
+		cfg.MinHosts = n
+	}
+	if cfg.SuccessRateStdevFactor == 0 {
+		cfg.SuccessRateStdevFactor = 1000
+	}
+	if cfg.LatencyFactor == 0 {
+		cfg.LatencyFactor = 1000
+	}
+	if cfg.LatencyPercentile == 0 {
+		cfg.LatencyPercentile = 50
+	}
+	return NewDetector("cart", discovery.Static(backends), cfg)
+}
+
+func record(d *Detector, name string, requests, failures int, latency time.Duration) {
+	for i := 0; i < requests; i++ {
+		d.Record(name, i < failures, latency)
+	}
+}
+
+func ejected(d *Detector, n int) []string {
+	var names []string
+	for i := 0; i < n; i++ {
+		if name := fmt.Sprintf("b%d", i); d.Ejected(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestConsecutiveErrors(t *testing.T) {
+	d := newTestDetector(3, config.OutlierDetection{ConsecutiveErrors: 3})
+	changes := 0
+	d.OnChange = func() { changes++ }
+
+	// A success in between starts the count over.
+	d.Record("b0", true, 0)
+	d.Record("b0", true, 0)
+	d.Record("b0", false, 0)
+	d.Record("b0", true, 0)
+	d.Record("b0", true, 0)
+	if d.Ejected("b0") {
+		t.Fatal("ejected after 2 errors in a row")
+	}
+	d.Record("b0", true, 0)
+	if !d.Ejected("b0") {
+		t.Fatal("not ejected after 3 errors in a row")
+	}
+	if st := d.Status("b0"); st.Reason != "3 consecutive errors" || st.Ejections != 1 {
+		t.Errorf("status = %+v", st)
+	}
+	if changes != 1 {
+		t.Errorf("OnChange called %d times, want 1", changes)
+	}
+}
+
+func TestSuccessRateOutlier(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures []int
+		requests int
+		minHosts int
+		want     []string
+	}{
+		// Rates 100, 100, 100, 100 and 50%: mean 90%, stdev 20%, so the
+		// threshold at 1.9 deviations is 52%.
+		{"outlier", []int{0, 0, 0, 0, 5}, 10, 5, []string{"b4"}},
+		{"within the spread", []int{0, 0, 0, 5, 5}, 10, 5, nil},
+		{"too few requests", []int{0, 0, 0, 0, 5}, 9, 5, nil},
+		{"too few hosts", []int{0, 0, 0, 5}, 10, 5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDetector(5, config.OutlierDetection{
+				MinHosts:               tt.minHosts,
+				MinRequests:            10,
+				SuccessRateStdevFactor: 1.9,
+			})
+			for i, failures := range tt.failures {
+				record(d, fmt.Sprintf("b%d", i), tt.requests, failures, 0)
+			}
+			d.Analyze(time.Now())
+			if got := ejected(d, 5); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ejected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatencyOutlier(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		samples   int
+		want      []string
+	}{
+		{"outlier", []time.Duration{10, 10, 12, 50}, 5, []string{"b3"}},
+		{"at the threshold", []time.Duration{10, 10, 10, 30}, 5, nil},
+		{"too few samples", []time.Duration{10, 10, 12, 50}, 4, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestDetector(4, config.OutlierDetection{
+				MinRequests:       5,
+				LatencyPercentile: 90,
+				LatencyFactor:     3,
+			})
+			for i, ms := range tt.latencies {
+				record(d, fmt.Sprintf("b%d", i), tt.samples, 0, ms*time.Millisecond)
+			}
+			d.Analyze(time.Now())
+			if got := ejected(d, 4); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ejected %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	d := newTestDetector(4, config.OutlierDetection{ConsecutiveErrors: 1, MaxEjectionPercent: 50})
+	for i := 0; i < 4; i++ {
+		d.Record(fmt.Sprintf("b%d", i), true, 0)
+	}
+	if got := ejected(d, 4); len(got) != 2 {
+		t.Errorf("ejected %v, want 2 of 4 backends at 50%%", got)
+	}
+}
+
+func TestNeverEjectsLastBackend(t *testing.T) {
+	for _, n := range []int{1, 2} {
+		d := newTestDetector(n, config.OutlierDetection{ConsecutiveErrors: 1})
+		for i := 0; i < n; i++ {
+			d.Record(fmt.Sprintf("b%d", i), true, 0)
+		}
+		if got := ejected(d, n); len(got) != n-1 {
+			t.Errorf("%d backends: ejected %v, want all but one", n, got)
+		}
+	}
+}
+
+func TestEjectionBackoff(t *testing.T) {
+	d := newTestDetector(2, config.OutlierDetection{
+		ConsecutiveErrors: 1,
+		BaseEjectionTime:  10 * time.Second,
+		MaxEjectionTime:   25 * time.Second,
+	})
+	now := time.Now()
+	for i, want := range []time.Duration{10 * time.Second, 20 * time.Second, 25 * time.Second, 25 * time.Second} {
+		start := time.Now()
+		d.Record("b0", true, 0)
+		st := d.Status("b0")
+		if got := st.EjectedUntil.Sub(start); !st.Ejected || got < want || got > want+time.Second {
+			t.Fatalf("ejection %d lasts %v, want %v", i+1, got, want)
+		}
+		// Return it to the pool.
+		now = now.Add(time.Minute)
+		d.Analyze(now)
+		if d.Ejected("b0") {
+			t.Fatalf("still ejected after ejection %d expired", i+1)
+		}
+	}
+
+	// Each interval the backend stays in the pool shortens the back-off again.
+	d.Analyze(now.Add(time.Minute))
+	d.Analyze(now.Add(2 * time.Minute))
+	if got := d.Status("b0").Ejections; got != 2 {
+		t.Errorf("ejections = %d after two quiet intervals, want 2", got)
+	}
+}
+
+func TestFailureRate(t *testing.T) {
+	d := newTestDetector(2, config.OutlierDetection{})
+	if got := d.FailureRate("b0"); got != 0 {
+		t.Errorf("failure rate without requests = %v", got)
+	}
+	record(d, "b0", 4, 1, 0)
+	if got := d.FailureRate("b0"); got != 0.25 {
+		t.Errorf("failure rate = %v, want 0.25", got)
+	}
+	// The last interval still counts.
+	d.Analyze(time.Now())
+	record(d, "b0", 4, 0, 0)
+	if got := d.FailureRate("b0"); got != 0.125 {
+		t.Errorf("failure rate = %v, want 0.125", got)
+	}
+	d.Analyze(time.Now())
+	if got := d.FailureRate("b0"); got != 0 {
+		t.Errorf("failure rate = %v after the failures' interval, want 0", got)
+	}
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Backend states an operator can set through the admin API.
+const (
+	// stateDraining takes a backend out of the pool while the requests it
+	// is serving finish.
+	stateDraining = "draining"
+	// stateDisabled takes a backend out of the pool.
+	stateDisabled = "disabled"
+	// stateEnabled keeps a backend in the pool even if it is unhealthy,
+	// ejected or its circuit is open.
+	stateEnabled = "enabled"
+)
+
+// override is an operator's change to one backend.
+type override struct {
+	// state is one of the states above, or empty to leave the backend to
+	// health checks, outlier detection and circuit breaking.
+	state string
+	// weight replaces the backend's configured weight if above 0.
+	weight int
+}
+
+func (svc *service) override(name string) override {
+	svc.overridesMu.Lock()
+	defer svc.overridesMu.Unlock()
+	return svc.overrides[name]
+}
+
+// setOverride applies change to a backend's override in one step and wakes
+// up watchers.
+func (svc *service) setOverride(name string, change func(*override)) {
+	svc.overridesMu.Lock()
+	o := svc.overrides[name]
+	change(&o)
+	if o == (override{}) {
+		delete(svc.overrides, name)
+	} else {
+		svc.overrides[name] = o
+	}
+	svc.overridesMu.Unlock()
+	svc.notify()
+}
+
+// adminState is the backend's override state for reports: active if there
+// is none, and drained once a draining backend has no request in flight.
+// svc.mu must be held.
+func (svc *service) adminState(b *backend) string {
+	switch state := svc.override(b.Name).state; state {
+	case "":
+		return "active"
+	case stateDraining:
+		if b.outstanding == 0 {
+			return "drained"
+		}
+		return state
+	default:
+		return state
+	}
+}
+
+// AdminHandler returns the handler of the admin API. Every request must
+// carry the configured token as a bearer token.
+func (s *SidecarServer) AdminHandler() (http.Handler, error) {
+	cfg := s.snapshot().cfg.Admin
+	token := cfg.Token
+	if cfg.TokenFile != "" {
+		data, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading admin token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, fmt.Errorf("admin token is empty")
+	}
+
+	const backend = "/admin/services/{service}/backends/{backend}"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/services", s.adminServices)
+	mux.HandleFunc("GET /admin/services/{service}", s.adminServices)
+	mux.HandleFunc("GET /admin/scores", s.adminScores)
+	mux.HandleFunc("POST "+backend+"/drain", s.adminSetState(stateDraining))
+	mux.HandleFunc("POST "+backend+"/disable", s.adminSetState(stateDisabled))
+	mux.HandleFunc("POST "+backend+"/enable", s.adminSetState(stateEnabled))
+	mux.HandleFunc("POST "+backend+"/resume", s.adminSetState(""))
+	mux.HandleFunc("PUT "+backend+"/weight", s.adminSetWeight)
+	mux.HandleFunc("DELETE "+backend+"/weight", s.adminSetWeight)
+	return requireToken(token, mux), nil
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sidecar-admin"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// adminServices lists every service, or the one in the path, with its
+// backends' live stats and overrides.
+func (s *SidecarServer) adminServices(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("service")
+	services, ok := s.snapshot().selectServices(name)
+	if !ok {
+		http.Error(w, "unknown service "+name, http.StatusNotFound)
+		return
+	}
+	if name != "" {
+		writeJSON(w, services[0].report(""))
+		return
+	}
+	reports := []serviceReport{}
+	for _, svc := range services {
+		reports = append(reports, svc.report(""))
+	}
+	writeJSON(w, reports)
+}
+
+// scoreRow is one backend in the score table.
+type scoreRow struct {
+	Service     string  `json:"service"`
+	Backend     string  `json:"backend"`
+	Weight      int     `json:"weight"`
+	Total       float64 `json:"total"`
+	CPU         float64 `json:"cpu"`
+	Memory      float64 `json:"memory"`
+	Network     float64 `json:"network"`
+	Errors      float64 `json:"errors"`
+	Outstanding int     `json:"outstanding"`
+	State       string  `json:"state"`
+	Unavailable string  `json:"unavailable,omitempty"`
+}
+
+// adminScores dumps the score table of every service, or of the one named
+// by the service query parameter, best first.
+func (s *SidecarServer) adminScores(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("service")
+	services, ok := s.snapshot().selectServices(name)
+	if !ok {
+		http.Error(w, "unknown service "+name, http.StatusNotFound)
+		return
+	}
+
+	rows := []scoreRow{}
+	for _, svc := range services {
+		var table []scoreRow
+		svc.mu.Lock()
+		for _, b := range svc.current() {
+			sc := svc.score(b)
+			table = append(table, scoreRow{
+				Service:     svc.name,
+				Backend:     b.Name,
+				Weight:      svc.weight(b),
+				Total:       sc.Total,
+				CPU:         sc.CPU,
+				Memory:      sc.Memory,
+				Network:     sc.Network,
+				Errors:      sc.Errors,
+				Outstanding: b.outstanding,
+				State:       svc.adminState(b),
+				Unavailable: svc.unavailable(b.Name),
+			})
+		}
+		svc.mu.Unlock()
+		sort.SliceStable(table, func(i, j int) bool { return table[i].Total < table[j].Total })
+		rows = append(rows, table...)
+	}
+	writeJSON(w, rows)
+}
+
+// adminBackend resolves the service and backend in the path, or writes a
+// 404 and returns false.
+func (s *SidecarServer) adminBackend(w http.ResponseWriter, r *http.Request) (*service, string, bool) {
+	svc, ok := s.snapshot().services[r.PathValue("service")]
+	if !ok {
+		http.Error(w, "unknown service "+r.PathValue("service"), http.StatusNotFound)
+		return nil, "", false
+	}
+	name := r.PathValue("backend")
+	found := false
+	svc.mu.Lock()
+	for _, b := range svc.current() {
+		if b.Name == name {
+			found = true
+			break
+		}
+	}
+	svc.mu.Unlock()
+	if !found {
+		http.Error(w, "unknown backend "+name, http.StatusNotFound)
+		return nil, "", false
+	}
+	return svc, name, true
+}
+
+// writeBackend answers an admin change with the backend's new report.
+func writeBackend(w http.ResponseWriter, svc *service, name string) {
+	report := svc.report(name)
+	if len(report.Backends) == 0 {
+		http.Error(w, "unknown backend "+name, http.StatusNotFound)
+		return
+	}
+	writeJSON(w, report.Backends[0])
+}
+
+// adminSetState sets a backend's state, or clears it if state is empty.
+func (s *SidecarServer) adminSetState(state string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		svc, name, ok := s.adminBackend(w, r)
+		if !ok {
+			return
+		}
+		svc.setOverride(name, func(o *override) { o.state = state })
+		slog.Info("admin changed backend state", "service", svc.name, "backend", name,
+			"state", state, "remote", r.RemoteAddr)
+		writeBackend(w, svc, name)
+	}
+}
+
+// adminSetWeight overrides a backend's weight with PUT {"weight": n} and
+// restores the configured one with DELETE.
+func (s *SidecarServer) adminSetWeight(w http.ResponseWriter, r *http.Request) {
+	svc, name, ok := s.adminBackend(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Weight int `json:"weight"`
+	}
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Weight < 1 {
+			http.Error(w, "weight must be at least 1", http.StatusBadRequest)
+			return
+		}
+	}
+	svc.setOverride(name, func(o *override) { o.weight = req.Weight })
+	slog.Info("admin changed backend weight", "service", svc.name, "backend", name,
+		"weight", req.Weight, "remote", r.RemoteAddr)
+	writeBackend(w, svc, name)
+}
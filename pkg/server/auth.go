@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"try/pkg/auth"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type identityKey struct{}
+
+// authUnary authenticates the caller of each unary call, if auth is on,
+// and passes its identity on in the context.
+func (s *SidecarServer) authUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authStream is authUnary for streaming calls, proxied ones included.
+func (s *SidecarServer) authStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// authenticate returns ctx with the caller's identity. The health service
+// is open to anyone, so that probes need no credentials.
+func (s *SidecarServer) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	a := s.snapshot().auth
+	if a == nil || strings.HasPrefix(fullMethod, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return ctx, nil
+	}
+
+	var bearer string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		var ok bool
+		if bearer, ok = strings.CutPrefix(values[0], "Bearer "); !ok {
+			slog.Warn("authentication failed", "method", fullMethod, "peer", peerAddr(ctx), "error", "not a bearer token")
+			return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+		}
+	}
+	id, err := a.Authenticate(bearer, verifiedChains(ctx))
+	if err != nil {
+		slog.Warn("authentication failed", "method", fullMethod, "peer", peerAddr(ctx), "error", err)
+		if errors.Is(err, auth.ErrNoCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "credentials are required")
+		}
+		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+	}
+	return context.WithValue(ctx, identityKey{}, id), nil
+}
+
+// authorize checks that the caller may route to service and logs the
+// decision for audit.
+func (s *SidecarServer) authorize(ctx context.Context, service string) error {
+	a := s.snapshot().auth
+	if a == nil {
+		return nil
+	}
+	id, ok := ctx.Value(identityKey{}).(auth.Identity)
+	method, _ := grpc.Method(ctx)
+	attrs := []any{"caller", id.Name, "auth", id.Method, "service", service, "method", method, "peer", peerAddr(ctx)}
+	if !ok || !a.Allowed(id.Name, service) {
+		slog.Warn("access denied", attrs...)
+		return status.Errorf(codes.PermissionDenied, "%q may not route to %q", id.Name, service)
+	}
+	slog.Info("access granted", attrs...)
+	return nil
+}
+
+// verifiedChains returns the caller's client certificate chains verified
+// during the TLS handshake, if any.
+func verifiedChains(ctx context.Context) [][]*x509.Certificate {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+	return info.State.VerifiedChains
+}
+
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"try/pkg/config"
+	pb "try/pkg/grpcapi"
+	"try/pkg/tracing"
+
+	"go.opentelemetry.io/otel/propagation"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxProxyBody keeps a proxied response well inside gRPC's default 4 MiB
+// message limit.
+const maxProxyBody = 4<<20 - 64<<10
+
+// backendResult is what RouteRequest observed calling the chosen backend.
+type backendResult struct {
+	statusCode int
+	latency    time.Duration
+	header     http.Header
+	body       []byte
+}
+
+// probeBackend sends the service's configured probe to the backend.
+func probeBackend(ctx context.Context, probe config.Probe, c candidate) (*backendResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, probe.Timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, probe.Method, c.URL()+probe.Path, nil)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "building probe for %s: %v", c.Name, err)
+	}
+	res, err := doBackendRequest(httpReq, false)
+	if err != nil {
+		return nil, err
+	}
+	if probe.ExpectedStatus != 0 && res.statusCode != probe.ExpectedStatus {
+		return res, status.Errorf(codes.Unavailable, "backend %s answered probe with %d, expected %d", c.Name, res.statusCode, probe.ExpectedStatus)
+	}
+	return res, nil
+}
+
+// proxyToBackend forwards the caller's request to the backend and returns
+// its response, whatever the status.
+func proxyToBackend(ctx context.Context, proxy config.Proxy, c candidate, req *pb.RouteRequestRequest) (*backendResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, proxy.Timeout)
+	defer cancel()
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+		if len(req.Body) > 0 {
+			method = http.MethodPost
+		}
+	}
+	path := req.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.URL()+path, bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid proxy request: %v", err)
+	}
+	for k, v := range req.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	return doBackendRequest(httpReq, true)
+}
+
+func doBackendRequest(httpReq *http.Request, readBody bool) (*backendResult, error) {
+	tracing.Propagator.Inject(httpReq.Context(), propagation.HeaderCarrier(httpReq.Header))
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "error calling backend %s: %v", httpReq.URL, err)
+	}
+	defer resp.Body.Close()
+
+	res := &backendResult{statusCode: resp.StatusCode, header: resp.Header}
+	if readBody {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProxyBody+1))
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "reading response from %s: %v", httpReq.URL, err)
+		}
+		if len(body) > maxProxyBody {
+			return nil, status.Errorf(codes.ResourceExhausted, "response from %s exceeds %d bytes", httpReq.URL, maxProxyBody)
+		}
+		res.body = body
+	}
+	res.latency = time.Since(start)
+	return res, nil
+}
+
+// backendFailed reports whether a probe or proxied request failed because of
+// the backend, for outlier detection.
+func backendFailed(r *backendResult, err error) bool {
+	if r != nil && r.statusCode >= 500 {
+		return true
+	}
+	return status.Code(err) == codes.Unavailable
+}
+
+// observedLatency is the request's latency, or 0 if it never got a response.
+func (r *backendResult) observedLatency() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return r.latency
+}
+
+func (r *backendResult) headers() map[string]string {
+	if r == nil || r.body == nil {
+		return nil
+	}
+	headers := map[string]string{}
+	for k, v := range r.header {
+		headers[k] = strings.Join(v, ", ")
+	}
+	return headers
+}
+
+func (r *backendResult) String() string {
+	return fmt.Sprintf("%d %s (took %v)", r.statusCode, http.StatusText(r.statusCode), r.latency)
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sort"
+	"time"
+
+	"try/pkg/circuit"
+	"try/pkg/health"
+	"try/pkg/outlier"
+)
+
+// dashboardFiles are the /graph page and its scripts, embedded so that the
+// dashboard works without access to a CDN.
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// serviceReport is a service as /data reports it.
+type serviceReport struct {
+	Name     string          `json:"name"`
+	Strategy string          `json:"strategy"`
+	Backends []backendReport `json:"backends"`
+}
+
+// backendReport is a backend as /data reports it. Outlier and Circuit are
+// nil if the service doesn't use them.
+type backendReport struct {
+	Name        string  `json:"name"`
+	URL         string  `json:"url"`
+	Weight      int     `json:"weight"`
+	CPU         float64 `json:"cpu"`
+	Memory      float64 `json:"memory"`
+	Network     float64 `json:"network"`
+	Score       float64 `json:"score"`
+	Outstanding int     `json:"outstanding"`
+	Served      int     `json:"served"`
+	// State is the operator's override (draining, drained, disabled or
+	// enabled) or active, and Unavailable why the backend is out of the
+	// pool, if it is.
+	State       string `json:"state"`
+	Unavailable string `json:"unavailable,omitempty"`
+	// Share is the backend's part of the requests the service served, from
+	// 0 to 1.
+	Share   float64         `json:"share"`
+	Health  health.Status   `json:"health"`
+	Outlier *outlier.Status `json:"outlier,omitempty"`
+	Circuit *circuit.Status `json:"circuit,omitempty"`
+	Series  []sample        `json:"series"`
+}
+
+// serveDashboard registers the /graph dashboard, the /events stream it
+// follows and the /data API on mux.
+func (s *SidecarServer) serveDashboard(mux *http.ServeMux) {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	mux.Handle("/graph/", http.StripPrefix("/graph/", http.FileServer(http.FS(files))))
+	mux.Handle("/graph", http.RedirectHandler("/graph/", http.StatusMovedPermanently))
+	mux.HandleFunc("/data", s.serveData)
+	mux.HandleFunc("/events", s.serveEvents)
+}
+
+// serveData reports every service's backends with their recent samples. The
+// service and backend query parameters narrow the report down to one of
+// each.
+func (s *SidecarServer) serveData(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("service")
+	services, ok := s.snapshot().selectServices(name)
+	if !ok {
+		http.Error(w, "unknown service "+name, http.StatusNotFound)
+		return
+	}
+
+	backendName := r.URL.Query().Get("backend")
+	reports := []serviceReport{}
+	for _, svc := range services {
+		report := svc.report(backendName)
+		if backendName != "" && len(report.Backends) == 0 {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	if backendName != "" && len(reports) == 0 {
+		http.Error(w, "unknown backend "+backendName, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timestamp": time.Now().Format(time.RFC3339),
+		"services":  reports,
+	})
+}
+
+// report returns the service's backends, or only the one named backendName
+// if it is not empty.
+func (svc *service) report(backendName string) serviceReport {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	report := serviceReport{Name: svc.name, Strategy: svc.strategy, Backends: []backendReport{}}
+	backends := svc.current()
+	total := 0
+	for _, b := range backends {
+		total += b.served
+	}
+	for _, b := range backends {
+		if backendName != "" && b.Name != backendName {
+			continue
+		}
+		br := backendReport{
+			Name:        b.Name,
+			URL:         b.URL(),
+			Weight:      svc.weight(b),
+			CPU:         b.metrics.CPUUsage,
+			Memory:      b.metrics.MemoryUsage,
+			Network:     b.metrics.NetworkTraffic,
+			Score:       svc.score(b).Total,
+			Outstanding: b.outstanding,
+			Served:      b.served,
+			State:       svc.adminState(b),
+			Unavailable: svc.unavailable(b.Name),
+			Health:      svc.healthStatus(b.Name),
+			Series:      append([]sample{}, b.series...),
+		}
+		if total > 0 {
+			br.Share = float64(b.served) / float64(total)
+		}
+		if svc.outliers != nil {
+			st := svc.outliers.Status(b.Name)
+			br.Outlier = &st
+		}
+		if svc.circuits != nil {
+			st := svc.circuits.Status(b.Name)
+			br.Circuit = &st
+		}
+		report.Backends = append(report.Backends, br)
+	}
+	sort.Slice(report.Backends, func(i, j int) bool { return report.Backends[i].Name < report.Backends[j].Name })
+	return report
+}
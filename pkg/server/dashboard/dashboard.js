@@ -0,0 +1,183 @@
+// Follows /events and shows every backend of the chosen service and its
+// routing decisions as they are made.
+'use strict';
+
+const colors = ['#e6194b', '#3cb44b', '#4363d8', '#f58231', '#911eb4', '#42d4f4', '#f032e6', '#bfef45', '#fabed4', '#dcbeff'];
+const serviceSelect = document.getElementById('service');
+const backendSelect = document.getElementById('backend');
+const charts = [...document.querySelectorAll('canvas[data-field]')].map(canvas => ({
+	field: canvas.dataset.field,
+	chart: new LineChart(canvas, canvas.dataset.title),
+}));
+const backendColors = {};
+
+function colorOf(name) {
+	if (!(name in backendColors)) {
+		backendColors[name] = colors[Object.keys(backendColors).length % colors.length];
+	}
+	return backendColors[name];
+}
+
+// setOptions replaces a select's options with values, keeping the selection
+// if it is still there. Options listed in keep stay in front.
+function setOptions(select, values, keep) {
+	const current = select.value;
+	select.replaceChildren(...keep.map(o => o.cloneNode(true)));
+	for (const v of values) {
+		select.add(new Option(v, v));
+	}
+	if ([...select.options].some(o => o.value === current)) {
+		select.value = current;
+	}
+}
+
+function cell(row, text, className) {
+	const td = row.insertCell();
+	td.textContent = text;
+	if (className) {
+		td.className = className;
+	}
+	return td;
+}
+
+function showTable(backends) {
+	const table = document.getElementById('backends');
+	table.replaceChildren();
+	const head = table.createTHead().insertRow();
+	for (const h of ['Backend', 'State', 'Health', 'Circuit', 'Outlier', 'Score', 'CPU %', 'Memory %', 'Network B/s', 'Outstanding', 'Served', 'Share', 'Latency']) {
+		const th = document.createElement('th');
+		th.textContent = h;
+		head.appendChild(th);
+	}
+	const body = table.createTBody();
+	for (const b of backends) {
+		const row = body.insertRow();
+		cell(row, '■ ' + b.name).style.color = colorOf(b.name);
+		cell(row, b.state, b.state === 'active' ? '' : 'half-open');
+		cell(row, b.health.healthy ? 'healthy' : 'unhealthy', b.health.healthy ? 'healthy' : 'unhealthy').title = b.health.last_error || '';
+		if (b.circuit) {
+			cell(row, b.circuit.state + ' (opened ' + b.circuit.opened + '×)', b.circuit.state);
+		} else {
+			cell(row, '-');
+		}
+		if (b.outlier && b.outlier.ejected) {
+			cell(row, 'ejected', 'ejected').title = b.outlier.reason || '';
+		} else {
+			cell(row, b.outlier ? 'in pool' : '-');
+		}
+		cell(row, b.score.toFixed(2), 'num');
+		cell(row, b.cpu.toFixed(1), 'num');
+		cell(row, b.memory.toFixed(1), 'num');
+		cell(row, formatValue(b.network), 'num');
+		cell(row, b.outstanding, 'num');
+		cell(row, b.served, 'num');
+		cell(row, (100 * b.share).toFixed(1) + '%', 'num');
+		const last = b.series.length ? b.series[b.series.length - 1] : null;
+		cell(row, last && last.latency_ms ? last.latency_ms.toFixed(1) + ' ms' : '-', 'num');
+	}
+}
+
+function showCharts(backends) {
+	for (const {field, chart} of charts) {
+		chart.update(backends.map(b => ({
+			label: b.name,
+			color: colorOf(b.name),
+			points: b.series.map(s => ({t: Date.parse(s.time), v: s[field]})),
+		})));
+	}
+}
+
+// seriesLength matches the number of samples the sidecar keeps.
+const seriesLength = 180;
+// maxDecisions is the number of routing decisions listed.
+const maxDecisions = 25;
+
+let services = [];
+let decisions = [];
+
+function showDecisions(service) {
+	const table = document.getElementById('decisions');
+	table.replaceChildren();
+	const head = table.createTHead().insertRow();
+	for (const h of ['Time', 'Via', 'Strategy', 'Selected', 'Served by', 'Score', 'Latency', 'Outcome']) {
+		const th = document.createElement('th');
+		th.textContent = h;
+		head.appendChild(th);
+	}
+	const body = table.createTBody();
+	for (const d of decisions.filter(d => d.service === service)) {
+		const row = body.insertRow();
+		if (d.error) {
+			row.className = 'failed';
+		}
+		cell(row, new Date(d.time).toLocaleTimeString());
+		cell(row, d.via);
+		cell(row, d.strategy);
+		cell(row, d.selected);
+		cell(row, d.backend).style.color = colorOf(d.backend);
+		cell(row, d.score.toFixed(2), 'num');
+		cell(row, d.latency_ms.toFixed(1) + ' ms', 'num');
+		const details = d.details || {};
+		cell(row, d.error || [details.status, details.code, details.attempts > 1 ? details.attempts + ' attempts' : '']
+			.filter(Boolean).join(' · ') || 'ok');
+	}
+}
+
+function render() {
+	setOptions(serviceSelect, services.map(s => s.name), []);
+	const service = services.find(s => s.name === serviceSelect.value);
+	if (!service) {
+		return;
+	}
+	setOptions(backendSelect, service.backends.map(b => b.name), [backendSelect.options[0]]);
+
+	const backends = backendSelect.value ? service.backends.filter(b => b.name === backendSelect.value) : service.backends;
+	showTable(backends);
+	showCharts(backends);
+	showDecisions(service.name);
+	document.getElementById('updated').textContent = service.strategy + ' · live';
+}
+
+// merge applies a service event, which carries each backend's latest sample
+// only, to the series received so far.
+function merge(update) {
+	const old = services.find(s => s.name === update.name);
+	for (const b of update.backends) {
+		const prev = old && old.backends.find(o => o.name === b.name);
+		const series = prev ? prev.series : [];
+		for (const s of b.series) {
+			if (!series.length || Date.parse(s.time) > Date.parse(series[series.length - 1].time)) {
+				series.push(s);
+			}
+		}
+		b.series = series.slice(-seriesLength);
+	}
+	services = old ? services.map(s => s === old ? update : s) : services.concat(update);
+}
+
+const events = new EventSource('/events');
+events.addEventListener('snapshot', e => {
+	services = JSON.parse(e.data).services;
+	render();
+});
+events.addEventListener('service', e => {
+	merge(JSON.parse(e.data));
+	render();
+});
+events.addEventListener('decision', e => {
+	const d = JSON.parse(e.data);
+	decisions.unshift(d);
+	decisions = decisions.slice(0, maxDecisions * Math.max(services.length, 1));
+	if (d.service === serviceSelect.value) {
+		showDecisions(d.service);
+	}
+});
+events.onerror = () => {
+	document.getElementById('updated').textContent = 'reconnecting…';
+};
+
+serviceSelect.addEventListener('change', () => {
+	backendSelect.value = '';
+	render();
+});
+backendSelect.addEventListener('change', render);
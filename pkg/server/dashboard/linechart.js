@@ -0,0 +1,124 @@
+// A minimal time series line chart on a canvas, so that the dashboard needs
+// no third-party scripts.
+'use strict';
+
+class LineChart {
+	constructor(canvas, title) {
+		this.canvas = canvas;
+		this.title = title;
+		this.series = [];
+		new ResizeObserver(() => this.draw()).observe(canvas);
+	}
+
+	// update replaces the plotted series: [{label, color, points: [{t, v}]}]
+	// with t in milliseconds.
+	update(series) {
+		this.series = series;
+		this.draw();
+	}
+
+	draw() {
+		const canvas = this.canvas;
+		const ratio = window.devicePixelRatio || 1;
+		const width = canvas.clientWidth, height = canvas.clientHeight;
+		if (width === 0 || height === 0) {
+			return;
+		}
+		canvas.width = width * ratio;
+		canvas.height = height * ratio;
+		const ctx = canvas.getContext('2d');
+		ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+		ctx.clearRect(0, 0, width, height);
+		ctx.font = '12px sans-serif';
+
+		const left = 60, right = 16, top = 28, bottom = 44;
+		const plotW = width - left - right, plotH = height - top - bottom;
+
+		ctx.fillStyle = 'white';
+		ctx.textAlign = 'left';
+		ctx.fillText(this.title, left, 18);
+
+		let minT = Infinity, maxT = -Infinity, maxV = 0;
+		for (const s of this.series) {
+			for (const p of s.points) {
+				minT = Math.min(minT, p.t);
+				maxT = Math.max(maxT, p.t);
+				maxV = Math.max(maxV, p.v);
+			}
+		}
+		if (minT === Infinity) {
+			ctx.fillStyle = '#888';
+			ctx.textAlign = 'center';
+			ctx.fillText('no samples yet', left + plotW / 2, top + plotH / 2);
+			return;
+		}
+		if (maxT === minT) {
+			maxT = minT + 1000;
+		}
+		const step = niceStep(maxV > 0 ? maxV : 1);
+		maxV = Math.max(step, Math.ceil(maxV / step) * step);
+		const x = t => left + (t - minT) / (maxT - minT) * plotW;
+		const y = v => top + plotH - v / maxV * plotH;
+
+		// Grid and axis labels.
+		ctx.strokeStyle = '#333';
+		ctx.fillStyle = '#aaa';
+		ctx.lineWidth = 1;
+		ctx.textAlign = 'right';
+		for (let v = 0; v <= maxV + step / 2; v += step) {
+			ctx.beginPath();
+			ctx.moveTo(left, y(v));
+			ctx.lineTo(left + plotW, y(v));
+			ctx.stroke();
+			ctx.fillText(formatValue(v), left - 6, y(v) + 4);
+		}
+		ctx.textAlign = 'center';
+		const ticks = Math.max(2, Math.floor(plotW / 110));
+		for (let i = 0; i <= ticks; i++) {
+			const t = minT + (maxT - minT) * i / ticks;
+			ctx.fillText(new Date(t).toLocaleTimeString(), x(t), top + plotH + 16);
+		}
+
+		// Lines.
+		ctx.lineWidth = 2;
+		for (const s of this.series) {
+			ctx.strokeStyle = s.color;
+			ctx.beginPath();
+			s.points.forEach((p, i) => i === 0 ? ctx.moveTo(x(p.t), y(p.v)) : ctx.lineTo(x(p.t), y(p.v)));
+			ctx.stroke();
+		}
+
+		// Legend.
+		ctx.textAlign = 'left';
+		let lx = left;
+		for (const s of this.series) {
+			ctx.fillStyle = s.color;
+			ctx.fillRect(lx, height - 14, 10, 10);
+			ctx.fillStyle = 'white';
+			ctx.fillText(s.label, lx + 14, height - 5);
+			lx += ctx.measureText(s.label).width + 34;
+		}
+	}
+}
+
+// niceStep returns a round grid step that splits 0..max into about 5 parts.
+function niceStep(max) {
+	const raw = max / 5;
+	const magnitude = Math.pow(10, Math.floor(Math.log10(raw)));
+	for (const m of [1, 2, 5, 10]) {
+		if (raw <= m * magnitude) {
+			return m * magnitude;
+		}
+	}
+	return 10 * magnitude;
+}
+
+function formatValue(v) {
+	if (v >= 1e6) {
+		return (v / 1e6).toFixed(1) + 'M';
+	}
+	if (v >= 1e3) {
+		return (v / 1e3).toFixed(1) + 'k';
+	}
+	return Number.isInteger(v) ? String(v) : v.toFixed(2);
+}
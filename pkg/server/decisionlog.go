@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// decision is one routing decision, logged once its outcome is known.
+type decision struct {
+	svc       *service
+	id        string
+	via       string
+	strategy  string
+	selected  candidate
+	fallbacks []candidate
+	start     time.Time
+}
+
+// candidateRecord is a candidate as it appears in decision records.
+type candidateRecord struct {
+	Name    string  `json:"name"`
+	CPU     float64 `json:"cpu"`
+	Memory  float64 `json:"memory"`
+	Network float64 `json:"network"`
+	Score   float64 `json:"score"`
+}
+
+func newDecision(svc *service, via, strategy string, selected candidate, fallbacks []candidate) *decision {
+	if strategy == "" {
+		strategy = svc.strategy
+	}
+	return &decision{
+		svc:       svc,
+		id:        newDecisionID(),
+		via:       via,
+		strategy:  strategy,
+		selected:  selected,
+		fallbacks: fallbacks,
+		start:     time.Now(),
+	}
+}
+
+// logDecision writes one record for d: every candidate's metrics and score,
+// the backend the balancer picked and the one that served the request, how
+// long it took, and attrs describing the outcome. Failed decisions are
+// logged at warn level; successful ones at info level, for a sample of
+// log.decision_sample_rate of them. Every decision is also sent to the
+// viewers of /events, unsampled.
+func (s *SidecarServer) logDecision(d *decision, served candidate, err error, attrs ...any) {
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	ctx := context.Background()
+	logged := slog.Default().Enabled(ctx, level) && (err != nil || s.snapshot().decisionSampler.Sample())
+	streamed := s.events.active()
+	if !logged && !streamed {
+		return
+	}
+	latency := time.Since(d.start)
+
+	candidates := make([]candidateRecord, 0, len(d.fallbacks)+1)
+	for _, c := range append([]candidate{d.selected}, d.fallbacks...) {
+		candidates = append(candidates, candidateRecord{
+			Name:    c.Name,
+			CPU:     c.metrics.CPUUsage,
+			Memory:  c.metrics.MemoryUsage,
+			Network: c.metrics.NetworkTraffic,
+			Score:   c.score.Total,
+		})
+	}
+	if streamed {
+		s.publishDecision(d, served, err, candidates, latency, attrs)
+	}
+	if !logged {
+		return
+	}
+
+	args := []any{
+		"service", d.svc.name,
+		"decision_id", d.id,
+		"via", d.via,
+		"strategy", d.strategy,
+		"selected", d.selected.Name,
+		"backend", served.Name,
+		"score", served.score.Total,
+		"candidates", candidates,
+		"latency", latency,
+	}
+	args = append(args, attrs...)
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	slog.Log(ctx, level, "routing decision", args...)
+}
+
+func (s *SidecarServer) publishDecision(d *decision, served candidate, err error, candidates []candidateRecord, latency time.Duration, attrs []any) {
+	e := decisionEvent{
+		Time:       d.start,
+		Service:    d.svc.name,
+		DecisionID: d.id,
+		Via:        d.via,
+		Strategy:   d.strategy,
+		Selected:   d.selected.Name,
+		Backend:    served.Name,
+		Score:      served.score.Total,
+		Candidates: candidates,
+		LatencyMS:  float64(latency) / float64(time.Millisecond),
+		Details:    map[string]any{},
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		key, ok := attrs[i].(string)
+		if !ok {
+			continue
+		}
+		value := attrs[i+1]
+		if dur, ok := value.(time.Duration); ok {
+			value = dur.String()
+		}
+		e.Details[key] = value
+	}
+	s.events.publish(d.svc.name, "decision", e)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventBuffer is the number of events a slow viewer may fall behind by
+// before it misses some.
+const eventBuffer = 64
+
+// keepAliveInterval is how often an idle event stream gets a comment, so
+// that proxies don't time it out.
+const keepAliveInterval = 15 * time.Second
+
+// event is one message of the /events stream, encoded once for every
+// viewer.
+type event struct {
+	service string
+	name    string
+	data    []byte
+}
+
+// eventHub fans events out to the viewers of /events. Publishing never
+// blocks: a viewer whose buffer is full misses the event.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan event]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: map[chan event]struct{}{}}
+}
+
+func (h *eventHub) subscribe() chan event {
+	ch := make(chan event, eventBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan event) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+// active reports whether anyone is watching, so that events nobody would see
+// are not built.
+func (h *eventHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers) > 0
+}
+
+// publish encodes v as JSON and sends it to every viewer.
+func (h *eventHub) publish(service, name string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("encoding event", "event", name, "error", err)
+		return
+	}
+	e := event{service: service, name: name, data: data}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publishServiceUpdates sends a service event, with each backend's latest
+// sample only, whenever svc changes, until stop is closed. One goroutine per
+// service builds the report, however many viewers there are.
+func (s *SidecarServer) publishServiceUpdates(svc *service, stop <-chan struct{}) {
+	for {
+		metricsChanged, backendsChanged := svc.watch()
+		if s.events.active() {
+			report := svc.report("")
+			for i := range report.Backends {
+				if series := report.Backends[i].Series; len(series) > 0 {
+					report.Backends[i].Series = series[len(series)-1:]
+				}
+			}
+			s.events.publish(svc.name, "service", report)
+		}
+		select {
+		case <-stop:
+			return
+		case <-metricsChanged:
+		case <-backendsChanged:
+		}
+	}
+}
+
+// decisionEvent is a routing decision as the /events stream reports it.
+type decisionEvent struct {
+	Time       time.Time         `json:"time"`
+	Service    string            `json:"service"`
+	DecisionID string            `json:"decision_id"`
+	Via        string            `json:"via"`
+	Strategy   string            `json:"strategy"`
+	Selected   string            `json:"selected"`
+	Backend    string            `json:"backend"`
+	Score      float64           `json:"score"`
+	Candidates []candidateRecord `json:"candidates"`
+	LatencyMS  float64           `json:"latency_ms"`
+	Error      string            `json:"error,omitempty"`
+	// Details are the outcome attributes of the decision's log record.
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// serveEvents streams server-sent events: a snapshot of every service (or
+// only the one named by the service query parameter) with its full series,
+// then a service event for each change and a decision event for each
+// routing decision.
+func (s *SidecarServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("service")
+	services, ok := s.snapshot().selectServices(name)
+	if !ok {
+		http.Error(w, "unknown service "+name, http.StatusNotFound)
+		return
+	}
+
+	// Subscribe before the snapshot so that no change made while building
+	// it is missed.
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	reports := []serviceReport{}
+	for _, svc := range services {
+		reports = append(reports, svc.report(""))
+	}
+	data, err := json.Marshal(map[string]interface{}{"services": reports})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if writeEvent(w, "snapshot", data) != nil || rc.Flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.draining:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e := <-ch:
+			if name != "" && e.service != name {
+				continue
+			}
+			if err := writeEvent(w, e.name, e.data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, data []byte) error {
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"try/pkg/config"
+	"try/pkg/tlsconfig"
+	"try/pkg/tracing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	_ "google.golang.org/grpc/encoding/proto" // registers the "proto" codec
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// frame is an undecoded gRPC message passed through the proxy as is.
+type frame struct {
+	payload []byte
+}
+
+// proxyCodec passes frames through untouched and hands every other message
+// to the proto codec, so SidecarService keeps working on a server that also
+// proxies.
+type proxyCodec struct {
+	proto encoding.Codec
+}
+
+func newProxyCodec() proxyCodec {
+	return proxyCodec{proto: encoding.GetCodec("proto")}
+}
+
+func (c proxyCodec) Marshal(v any) ([]byte, error) {
+	if f, ok := v.(*frame); ok {
+		return f.payload, nil
+	}
+	return c.proto.Marshal(v)
+}
+
+func (c proxyCodec) Unmarshal(data []byte, v any) error {
+	if f, ok := v.(*frame); ok {
+		f.payload = append(f.payload[:0], data...)
+		return nil
+	}
+	return c.proto.Unmarshal(data, v)
+}
+
+func (c proxyCodec) Name() string {
+	return c.proto.Name()
+}
+
+// GRPCServerOptions returns the options that trace and authenticate every
+// call, serve TLS if it is configured and, if grpc_proxy is enabled, turn
+// the gRPC server into a proxy for other gRPC services.
+func (s *SidecarServer) GRPCServerOptions() []grpc.ServerOption {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.traceUnary, s.authUnary),
+		grpc.ChainStreamInterceptor(s.traceStream, s.authStream),
+	}
+	if s.tlsFiles != nil {
+		clientAuth := map[string]tls.ClientAuthType{
+			config.ClientAuthNone:     tls.NoClientCert,
+			config.ClientAuthOptional: tls.VerifyClientCertIfGiven,
+			config.ClientAuthRequire:  tls.RequireAndVerifyClientCert,
+		}[s.snapshot().cfg.TLS.ClientAuth]
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsconfig.ServerConfig(s.tlsFiles, clientAuth))))
+	}
+	if !s.snapshot().cfg.GRPCProxy.Enabled {
+		return opts
+	}
+	return append(opts,
+		grpc.ForceServerCodec(newProxyCodec()),
+		grpc.UnknownServiceHandler(s.proxyGRPC),
+	)
+}
+
+// proxyGRPC forwards a call to a service the server doesn't implement to a
+// backend picked by the balancer. Messages, headers and trailers are relayed
+// in both directions, so unary and streaming calls both work.
+func (s *SidecarServer) proxyGRPC(_ any, serverStream grpc.ServerStream) error {
+	ctx := serverStream.Context()
+	method, ok := grpc.MethodFromServerStream(serverStream)
+	if !ok {
+		return status.Error(codes.Internal, "no method in stream")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	svc, err := s.grpcProxyService(md)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, svc.name); err != nil {
+		return err
+	}
+
+	selected, fallbacks, err := s.chooseBackend(ctx, svc, "")
+	if err != nil {
+		return err
+	}
+	defer s.release(svc, selected)
+	d := newDecision(svc, viaGRPCProxy, "", selected, fallbacks)
+	spanCtx, span := s.startBackendSpan(ctx, svc, selected, 1)
+	err = s.relayGRPC(spanCtx, svc, selected, method, md, serverStream)
+	endBackendSpan(span, 0, err)
+	s.logDecision(d, selected, err, "method", method, "code", status.Code(err).String())
+	return err
+}
+
+// relayGRPC relays a proxied call to the selected backend and back.
+func (s *SidecarServer) relayGRPC(ctx context.Context, svc *service, selected candidate, method string, md metadata.MD, serverStream grpc.ServerStream) error {
+	conn, err := s.backendConns.get(net.JoinHostPort(selected.Address, strconv.Itoa(selected.Port)))
+	if err != nil {
+		svc.observe(selected.Name, true, 0)
+		return status.Errorf(codes.Unavailable, "connecting to backend %s: %v", selected.Name, err)
+	}
+
+	// The caller's credential is for the sidecar; backends must not see it.
+	stripAuth := s.snapshot().auth != nil
+	out := metadata.MD{}
+	for k, v := range md {
+		if strings.HasPrefix(k, ":") || (stripAuth && k == "authorization") {
+			continue
+		}
+		out[k] = v
+	}
+	// The backend's trace continues from the backend call's span, not the
+	// caller's.
+	tracing.Propagator.Inject(ctx, tracing.MetadataCarrier(out))
+	clientCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	clientStream, err := conn.NewStream(metadata.NewOutgoingContext(clientCtx, out),
+		&grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, method, grpc.ForceCodec(newProxyCodec()))
+	if err != nil {
+		if serverStream.Context().Err() == nil {
+			svc.observe(selected.Name, grpcBackendFailed(err), 0)
+		}
+		return err
+	}
+
+	// Caller to backend. A clean end of the caller's stream is passed on as
+	// CloseSend; anything else cancels the backend call.
+	toBackend := make(chan error, 1)
+	go func() {
+		for {
+			f := &frame{}
+			if err := serverStream.RecvMsg(f); err != nil {
+				if err == io.EOF {
+					clientStream.CloseSend()
+					toBackend <- nil
+				} else {
+					toBackend <- err
+				}
+				return
+			}
+			if err := clientStream.SendMsg(f); err != nil {
+				toBackend <- err
+				return
+			}
+		}
+	}()
+
+	// Backend to caller, ending with the backend's status and trailers.
+	fromBackend := make(chan error, 1)
+	go func() {
+		header, err := clientStream.Header()
+		if err == nil {
+			err = serverStream.SendHeader(header)
+		}
+		for err == nil {
+			f := &frame{}
+			if err = clientStream.RecvMsg(f); err == nil {
+				err = serverStream.SendMsg(f)
+			}
+		}
+		serverStream.SetTrailer(clientStream.Trailer())
+		fromBackend <- err
+	}()
+
+	for {
+		select {
+		case err := <-toBackend:
+			if err != nil {
+				// The backend goroutine may still be writing to the
+				// caller's stream, which must be over when we return.
+				cancel()
+				<-fromBackend
+				return status.Errorf(codes.Canceled, "caller stream failed: %v", err)
+			}
+			toBackend = nil
+		case err := <-fromBackend:
+			// Calls may be streams, so their duration is not a latency
+			// sample.
+			if errors.Is(err, io.EOF) {
+				s.countRequest(svc, selected, viaGRPCProxy)
+				svc.observe(selected.Name, false, 0)
+				return nil
+			}
+			// A call the caller canceled or let run past its deadline
+			// says nothing about the backend.
+			if status.Code(err) != codes.Canceled && serverStream.Context().Err() == nil {
+				svc.observe(selected.Name, grpcBackendFailed(err), 0)
+			}
+			return err
+		}
+	}
+}
+
+// grpcBackendFailed reports whether a proxied call's error points at the
+// backend rather than the request, for outlier detection.
+func grpcBackendFailed(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Internal, codes.Unknown, codes.DataLoss, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// grpcProxyService resolves the service a proxied call is for.
+func (s *SidecarServer) grpcProxyService(md metadata.MD) (*service, error) {
+	snap := s.snapshot()
+	proxy := snap.cfg.GRPCProxy
+	if v := md.Get(proxy.MetadataKey); len(v) > 0 {
+		svc, ok := snap.services[v[0]]
+		if !ok {
+			return nil, status.Errorf(codes.NotFound, "unknown service %q", v[0])
+		}
+		return svc, nil
+	}
+	if v := md.Get(":authority"); len(v) > 0 {
+		host := v[0]
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if name, ok := proxy.Authorities[host]; ok {
+			return snap.services[name], nil
+		}
+	}
+	return nil, status.Errorf(codes.Unimplemented, "no route for call: set the %s header or use a mapped authority", proxy.MetadataKey)
+}
+
+// connPool keeps one client connection per backend address; gRPC
+// multiplexes every proxied call over it.
+type connPool struct {
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+func (p *connPool) get(target string) (*grpc.ClientConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn, ok := p.conns[target]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	if p.conns == nil {
+		p.conns = map[string]*grpc.ClientConn{}
+	}
+	p.conns[target] = conn
+	return conn, nil
+}
+
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for target, conn := range p.conns {
+		conn.Close()
+		delete(p.conns, target)
+	}
+}
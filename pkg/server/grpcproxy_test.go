@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// slowGRPCBackend serves every method by waiting for delay or the end of the
+// call, and returns its host and port.
+func slowGRPCBackend(t *testing.T, delay time.Duration) (string, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		select {
+		case <-time.After(delay):
+			return stream.SendMsg(&emptypb.Empty{})
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	host, port, _ := net.SplitHostPort(lis.Addr().String())
+	return host, port
+}
+
+func TestGRPCProxyCallerDeadlineIsNotABackendFailure(t *testing.T) {
+	host, port := slowGRPCBackend(t, 300*time.Millisecond)
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+grpc_proxy:
+  enabled: true
+services:
+  - name: cart
+    outlier_detection:
+      enabled: true
+      consecutive_errors: 3
+      max_ejection_percent: 100
+    circuit_breaker:
+      enabled: true
+      consecutive_failures: 3
+      open_duration: 1h
+    backends:
+      - name: cart-1
+        address: `+host+`
+        port: `+port+`
+`)
+	conn := dialConn(t, s)
+	call := func(timeout time.Duration) error {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-sidecar-service", "cart")
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return conn.Invoke(ctx, "/shop.Cart/Get", &emptypb.Empty{}, &emptypb.Empty{})
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := call(30 * time.Millisecond); status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("impatient call %d: %v, want DeadlineExceeded", i, err)
+		}
+	}
+	// Let the sidecar finish the calls the callers gave up on.
+	time.Sleep(100 * time.Millisecond)
+
+	svc := s.snapshot().services["cart"]
+	if why := svc.unavailable("cart-1"); why != "" {
+		t.Errorf("cart-1 is %s after callers gave up on it", why)
+	}
+	if rate := svc.outliers.FailureRate("cart-1"); rate != 0 {
+		t.Errorf("cart-1 failure rate = %v, want 0", rate)
+	}
+	if err := call(0); err != nil {
+		t.Fatalf("patient call: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// servingStatus is the health of the service called name, or of the sidecar
+// as a whole if name is empty, with the reason if it is not serving. A
+// service is not serving while none of its backends can be routed to or
+// after too many failed metrics refreshes; the sidecar is not serving once
+// shutdown starts or while none of its services is. It is SERVICE_UNKNOWN if
+// there is no such service.
+func (s *SidecarServer) servingStatus(snap *snapshot, name string) (healthpb.HealthCheckResponse_ServingStatus, string) {
+	services, ok := snap.selectServices(name)
+	if !ok {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, "unknown service"
+	}
+	select {
+	case <-s.shuttingDown:
+		return healthpb.HealthCheckResponse_NOT_SERVING, "shutting down"
+	default:
+	}
+	if name != "" {
+		return services[0].servingStatus(snap.cfg.Readiness.MaxMetricsFailures)
+	}
+	for _, svc := range services {
+		if st, _ := svc.servingStatus(snap.cfg.Readiness.MaxMetricsFailures); st == healthpb.HealthCheckResponse_SERVING {
+			return st, ""
+		}
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING, "no service can be routed to"
+}
+
+func (svc *service) servingStatus(maxMetricsFailures int) (healthpb.HealthCheckResponse_ServingStatus, string) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if svc.metricsFailures >= maxMetricsFailures {
+		return healthpb.HealthCheckResponse_NOT_SERVING,
+			fmt.Sprintf("%d metrics refreshes failed in a row", svc.metricsFailures)
+	}
+	backends := svc.current()
+	if len(backends) == 0 {
+		return healthpb.HealthCheckResponse_NOT_SERVING, "no backends"
+	}
+	for _, b := range backends {
+		if svc.unavailable(b.Name) == "" {
+			return healthpb.HealthCheckResponse_SERVING, ""
+		}
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING, "no backend is available"
+}
+
+// Ready reports whether the sidecar as a whole is serving, as /readyz does.
+func (s *SidecarServer) Ready() bool {
+	st, _ := s.servingStatus(s.snapshot(), "")
+	return st == healthpb.HealthCheckResponse_SERVING
+}
+
+// HealthServer returns the grpc.health.v1.Health service of the sidecar.
+// It reports every configured service by name, and the sidecar as a whole
+// under the empty name.
+func (s *SidecarServer) HealthServer() healthpb.HealthServer {
+	return healthServer{s: s}
+}
+
+type healthServer struct {
+	healthpb.UnimplementedHealthServer
+	s *SidecarServer
+}
+
+func (h healthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	st, _ := h.s.servingStatus(h.s.snapshot(), req.Service)
+	if st == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+	}
+	return &healthpb.HealthCheckResponse{Status: st}, nil
+}
+
+// Watch sends the status of the service at once and then whenever it
+// changes. An unknown service is reported as SERVICE_UNKNOWN until a reload
+// adds it.
+func (h healthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	s := h.s
+	shuttingDown := s.shuttingDown
+	last := healthpb.HealthCheckResponse_ServingStatus(-1)
+	for {
+		// Take the channels before the status so that a change made while
+		// computing it is not missed.
+		snap := s.snapshot()
+		services, _ := snap.selectServices(req.Service)
+		changed, stopWatching := watchServices(services)
+		st, _ := s.servingStatus(snap, req.Service)
+		if st != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: st}); err != nil {
+				stopWatching()
+				return err
+			}
+			last = st
+		}
+
+		select {
+		case <-stream.Context().Done():
+			stopWatching()
+			return nil
+		case <-s.draining:
+			stopWatching()
+			return status.Error(codes.Unavailable, "sidecar is shutting down")
+		case <-shuttingDown:
+			shuttingDown = nil
+		case <-snap.retired:
+		case <-changed:
+		}
+		stopWatching()
+	}
+}
+
+// watchServices returns a channel that is closed when any of services
+// changes, and a function to call once it is no longer needed.
+func watchServices(services []*service) (<-chan struct{}, func()) {
+	changed := make(chan struct{})
+	done := make(chan struct{})
+	var once sync.Once
+	for _, svc := range services {
+		metricsChanged, backendsChanged := svc.watch()
+		go func() {
+			select {
+			case <-done:
+				return
+			case <-metricsChanged:
+			case <-backendsChanged:
+			}
+			once.Do(func() { close(changed) })
+		}()
+	}
+	return changed, func() { close(done) }
+}
+
+// serveHealth answers /healthz and /readyz. /healthz only shows that the
+// sidecar is up and answering; /readyz fails with 503 unless the sidecar, or
+// the service named by the service query parameter, is serving.
+func (s *SidecarServer) serveHealth(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		snap := s.snapshot()
+		name := r.URL.Query().Get("service")
+		st, reason := s.servingStatus(snap, name)
+		if st == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+			http.Error(w, "unknown service "+name, http.StatusNotFound)
+			return
+		}
+
+		var b strings.Builder
+		if st == healthpb.HealthCheckResponse_SERVING {
+			b.WriteString("ready\n")
+		} else {
+			fmt.Fprintf(&b, "not ready: %s\n", reason)
+		}
+		services, _ := snap.selectServices(name)
+		for _, svc := range services {
+			st, reason := s.servingStatus(snap, svc.name)
+			fmt.Fprintf(&b, "%s: %s", svc.name, st)
+			if reason != "" {
+				fmt.Fprintf(&b, " (%s)", reason)
+			}
+			b.WriteString("\n")
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if st != healthpb.HealthCheckResponse_SERVING {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, b.String())
+	})
+}
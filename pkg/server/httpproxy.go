@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"try/pkg/config"
+	"try/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type proxyTargetKey struct{}
+
+// proxyTarget is the backend chosen for one proxied request, and what came
+// of sending the request to it.
+type proxyTarget struct {
+	route config.Route
+	url   *url.URL
+	start time.Time
+
+	statusCode int
+	latency    time.Duration
+	err        error
+}
+
+// HTTPProxy returns the handler of the HTTP reverse proxy. Requests are
+// matched to a service by the http_proxy routes and sent to the backend the
+// service's balancer picks, with request and response bodies streamed
+// through.
+func (s *SidecarServer) HTTPProxy() http.Handler {
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			t := pr.In.Context().Value(proxyTargetKey{}).(*proxyTarget)
+			if t.route.StripPrefix && t.route.PathPrefix != "" {
+				path := strings.TrimPrefix(pr.Out.URL.Path, strings.TrimSuffix(t.route.PathPrefix, "/"))
+				if !strings.HasPrefix(path, "/") {
+					path = "/" + path
+				}
+				pr.Out.URL.Path = path
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(t.url)
+			pr.SetXForwarded()
+			if t.route.PreserveHost {
+				pr.Out.Host = pr.In.Host
+			}
+			for _, h := range t.route.RemoveHeaders {
+				pr.Out.Header.Del(h)
+			}
+			for k, v := range t.route.SetHeaders {
+				pr.Out.Header.Set(k, v)
+			}
+			tracing.Propagator.Inject(pr.Out.Context(), propagation.HeaderCarrier(pr.Out.Header))
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			t := resp.Request.Context().Value(proxyTargetKey{}).(*proxyTarget)
+			t.statusCode = resp.StatusCode
+			t.latency = time.Since(t.start)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			t := r.Context().Value(proxyTargetKey{}).(*proxyTarget)
+			t.err = err
+			if errors.Is(err, context.DeadlineExceeded) {
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snap := s.snapshot()
+		route, ok := matchRoute(snap.cfg.HTTPProxy.Routes, r)
+		if !ok {
+			http.Error(w, "no route for request", http.StatusNotFound)
+			return
+		}
+		svc := snap.services[route.Service]
+
+		ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := s.tracer.Start(ctx, "http proxy", trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("sidecar.service", svc.name),
+		))
+		defer span.End()
+
+		selected, fallbacks, err := s.chooseBackend(ctx, svc, "")
+		if err != nil {
+			span.SetStatus(otelcodes.Error, err.Error())
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer s.release(svc, selected)
+		target, err := url.Parse(selected.URL())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		d := newDecision(svc, viaHTTPProxy, "", selected, fallbacks)
+		ctx, cancel := context.WithTimeout(ctx, route.Timeout)
+		defer cancel()
+		ctx, backendSpan := s.startBackendSpan(ctx, svc, selected, 1)
+		t := &proxyTarget{route: route, url: target, start: time.Now()}
+		rp.ServeHTTP(w, r.WithContext(context.WithValue(ctx, proxyTargetKey{}, t)))
+		endBackendSpan(backendSpan, t.statusCode, t.err)
+		span.SetAttributes(
+			attribute.String("sidecar.backend", selected.Name),
+			attribute.Float64("sidecar.score", selected.score.Total),
+			attribute.String("sidecar.decision_id", d.id),
+		)
+		if t.err != nil || t.statusCode >= 500 {
+			span.SetStatus(otelcodes.Error, "")
+		}
+		s.countRequest(svc, selected, viaHTTPProxy)
+		switch {
+		case errors.Is(t.err, context.Canceled):
+			// The client went away, which says nothing about the backend.
+		case t.err != nil:
+			svc.observe(selected.Name, true, 0)
+		default:
+			svc.observe(selected.Name, t.statusCode >= 500, t.latency)
+		}
+		s.logDecision(d, selected, t.err, "method", r.Method, "path", r.URL.Path, "status", t.statusCode)
+	})
+}
+
+// matchRoute returns the route for a request: among those whose host and
+// path prefix match, the longest prefix wins, then a route with a host over
+// one without.
+func matchRoute(routes []config.Route, r *http.Request) (config.Route, bool) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	best := -1
+	for i, route := range routes {
+		if route.Host != "" && !strings.EqualFold(route.Host, host) {
+			continue
+		}
+		if !pathHasPrefix(r.URL.Path, route.PathPrefix) {
+			continue
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		b := routes[best]
+		if len(route.PathPrefix) > len(b.PathPrefix) ||
+			(len(route.PathPrefix) == len(b.PathPrefix) && route.Host != "" && b.Host == "") {
+			best = i
+		}
+	}
+	if best < 0 {
+		return config.Route{}, false
+	}
+	return routes[best], true
+}
+
+// pathHasPrefix reports whether prefix matches path at a segment boundary,
+// so that /users matches /users and /users/1 but not /usersettings.
+func pathHasPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"try/pkg/config"
+)
+
+func TestMatchRoute(t *testing.T) {
+	routes := []config.Route{
+		{PathPrefix: "/", Service: "web"},
+		{PathPrefix: "/users", Service: "users"},
+		{PathPrefix: "/api/", Service: "api"},
+		{Host: "admin.example.com", PathPrefix: "/users", Service: "admin"},
+	}
+	tests := []struct {
+		host, path string
+		want       string
+	}{
+		{"example.com", "/users", "users"},
+		{"example.com", "/users/1", "users"},
+		{"example.com", "/usersettings", "web"},
+		{"example.com", "/api/orders", "api"},
+		{"example.com", "/api", "web"},
+		{"example.com", "/apiv2", "web"},
+		{"admin.example.com:8080", "/users/1", "admin"},
+		{"ADMIN.example.com", "/users", "admin"},
+		{"admin.example.com", "/usersettings", "web"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://"+tt.host+tt.path, nil)
+		route, ok := matchRoute(routes, r)
+		if !ok || route.Service != tt.want {
+			t.Errorf("%s%s: routed to %q, want %q", tt.host, tt.path, route.Service, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/usersettings", nil)
+	if route, ok := matchRoute(routes[1:2], r); ok {
+		t.Errorf("/usersettings matched %q", route.PathPrefix)
+	}
+}
+
+func TestHTTPProxyStripsPrefix(t *testing.T) {
+	paths := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+	}))
+	defer backend.Close()
+	host, port := backendAddr(t, backend)
+
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+http_proxy:
+  listen: 127.0.0.1:0
+  routes:
+    - path_prefix: /users
+      service: users
+      strip_prefix: true
+services:
+  - name: users
+    backends:
+      - name: users-1
+        address: `+host+`
+        port: `+port+`
+`)
+	proxy := httptest.NewServer(s.HTTPProxy())
+	defer proxy.Close()
+
+	for path, want := range map[string]string{"/users": "/", "/users/1": "/1"} {
+		resp, err := http.Get(proxy.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if got := <-paths; got != want {
+			t.Errorf("%s forwarded as %s, want %s", path, got, want)
+		}
+	}
+	resp, err := http.Get(proxy.URL + "/usersettings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/usersettings: status %d, want 404", resp.StatusCode)
+	}
+}
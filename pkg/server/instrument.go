@@ -0,0 +1,144 @@
+package server
+
+import (
+	"net/http"
+
+	"try/pkg/circuit"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Ways a request reaches the sidecar, for the via label.
+const (
+	viaRouteRequest = "route_request"
+	viaHTTPProxy    = "http_proxy"
+	viaGRPCProxy    = "grpc_proxy"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_requests_total",
+		Help: "Requests routed to a backend, by how they reached the sidecar.",
+	}, []string{"service", "backend", "via"})
+	noBackendTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_no_backend_total",
+		Help: "Requests that found no backend to route to.",
+	}, []string{"service"})
+	selectedScore = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sidecar_selected_score",
+		Help:    "Score of the backend chosen for each request; lower is less loaded.",
+		Buckets: prometheus.LinearBuckets(0, 10, 11),
+	}, []string{"service"})
+	backendCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_backend_calls_total",
+		Help: "Requests the sidecar sent to backends, by result (success or failure).",
+	}, []string{"service", "backend", "result"})
+	backendCallDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sidecar_backend_call_duration_seconds",
+		Help:    "Time until a backend answered a probe or proxied request.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "backend"})
+	metricsRefreshDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "sidecar_metrics_refresh_duration_seconds",
+		Help:    "Time taken to fetch a service's backend metrics from its metrics source.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "source"})
+	metricsRefreshErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sidecar_metrics_refresh_errors_total",
+		Help: "Failed fetches of a service's backend metrics.",
+	}, []string{"service", "source"})
+)
+
+var (
+	backendScoreDesc = prometheus.NewDesc("sidecar_backend_score",
+		"Current score of a backend; lower is less loaded.", []string{"service", "backend"}, nil)
+	backendOutstandingDesc = prometheus.NewDesc("sidecar_backend_outstanding",
+		"Requests in flight to a backend.", []string{"service", "backend"}, nil)
+	backendHealthyDesc = prometheus.NewDesc("sidecar_backend_healthy",
+		"1 if a backend passes its health checks or has none, 0 otherwise.", []string{"service", "backend"}, nil)
+	backendEjectedDesc = prometheus.NewDesc("sidecar_backend_ejected",
+		"1 while outlier detection keeps a backend out of the pool.", []string{"service", "backend"}, nil)
+	circuitStateDesc = prometheus.NewDesc("sidecar_circuit_state",
+		"1 for the state a backend's circuit is in, 0 for the others.", []string{"service", "backend", "state"}, nil)
+	circuitOpenedDesc = prometheus.NewDesc("sidecar_circuit_opened_total",
+		"Times a backend's circuit has opened.", []string{"service", "backend"}, nil)
+)
+
+// backendCollector reports the state of every backend as it is at scrape
+// time.
+type backendCollector struct {
+	s *SidecarServer
+}
+
+func (c backendCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- backendScoreDesc
+	ch <- backendOutstandingDesc
+	ch <- backendHealthyDesc
+	ch <- backendEjectedDesc
+	ch <- circuitStateDesc
+	ch <- circuitOpenedDesc
+}
+
+func (c backendCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, svc := range c.s.snapshot().services {
+		svc.mu.Lock()
+		type row struct {
+			backend     string
+			score       float64
+			outstanding int
+		}
+		var rows []row
+		for _, b := range svc.current() {
+			rows = append(rows, row{b.Name, svc.score(b).Total, b.outstanding})
+		}
+		svc.mu.Unlock()
+
+		for _, r := range rows {
+			ch <- prometheus.MustNewConstMetric(backendScoreDesc, prometheus.GaugeValue, r.score, name, r.backend)
+			ch <- prometheus.MustNewConstMetric(backendOutstandingDesc, prometheus.GaugeValue, float64(r.outstanding), name, r.backend)
+			ch <- prometheus.MustNewConstMetric(backendHealthyDesc, prometheus.GaugeValue, boolValue(svc.healthStatus(r.backend).Healthy), name, r.backend)
+			if svc.outliers != nil {
+				ch <- prometheus.MustNewConstMetric(backendEjectedDesc, prometheus.GaugeValue, boolValue(svc.ejected(r.backend)), name, r.backend)
+			}
+			if svc.circuits != nil {
+				st := svc.circuits.Status(r.backend)
+				for _, state := range []circuit.State{circuit.Closed, circuit.Open, circuit.HalfOpen} {
+					ch <- prometheus.MustNewConstMetric(circuitStateDesc, prometheus.GaugeValue,
+						boolValue(st.State == state.String()), name, r.backend, state.String())
+				}
+				ch <- prometheus.MustNewConstMetric(circuitOpenedDesc, prometheus.CounterValue, float64(st.Opened), name, r.backend)
+			}
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func newRegistry(s *SidecarServer) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		noBackendTotal,
+		selectedScore,
+		backendCallsTotal,
+		backendCallDuration,
+		metricsRefreshDuration,
+		metricsRefreshErrors,
+		backendCollector{s},
+	)
+	return reg
+}
+
+// MetricsHandler serves the sidecar's own metrics in the Prometheus format.
+func (s *SidecarServer) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{})
+}
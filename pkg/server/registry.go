@@ -0,0 +1,363 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"try/pkg/balancer"
+	"try/pkg/circuit"
+	"try/pkg/config"
+	"try/pkg/discovery"
+	"try/pkg/health"
+	"try/pkg/metrics"
+	"try/pkg/outlier"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type service struct {
+	name    string
+	source  discovery.Source
+	metrics metrics.Source
+	// metricsSource names metrics for sidecar_metrics_refresh_*.
+	metricsSource string
+	strategy      string
+	mode          string
+	// decisionHold is how long a decision-only pick counts as outstanding.
+	decisionHold time.Duration
+	probe        config.Probe
+	proxy        config.Proxy
+	retry        config.Retry
+	// retryBudget is shared by all of the service's RouteRequest calls.
+	retryBudget *retryBudget
+	// health is nil if the service has no active health check.
+	health *health.Monitor
+	// outliers is nil if outlier detection is off.
+	outliers *outlier.Detector
+	// circuits is nil if circuit breaking is off.
+	circuits *circuit.Breakers
+	// checks runs health and outliers; it is shared with the services that
+	// replace svc while its configuration is unchanged.
+	checks *checks
+
+	balancersMu sync.Mutex
+	balancers   map[string]balancer.Balancer
+
+	// overridesMu guards overrides, the changes operators made through the
+	// admin API by backend name. They outlive discovery updates.
+	overridesMu sync.Mutex
+	overrides   map[string]override
+
+	// mu guards backends, the per-backend state that is carried across
+	// discovery updates and metric refreshes, and changed.
+	mu       sync.Mutex
+	backends map[string]*backend
+	// changed is closed and replaced by notify.
+	changed chan struct{}
+	// metricsFailures counts the metrics refreshes that failed in a row.
+	metricsFailures int
+	// retired is closed once a reload replaced the service.
+	retired <-chan struct{}
+}
+
+// checks owns the background work of a service's health monitor and
+// outlier detector, and passes their and the circuit breakers' changes on to
+// the service currently using them.
+type checks struct {
+	// owner is the service notified of changes.
+	owner atomic.Pointer[service]
+	// stop ends health checking and outlier analysis.
+	stop      chan struct{}
+	startOnce sync.Once
+}
+
+func (c *checks) notify() {
+	if svc := c.owner.Load(); svc != nil {
+		svc.notify()
+	}
+}
+
+type backend struct {
+	discovery.Backend
+	metrics     metrics.BackendMetrics
+	history     []metrics.BackendMetrics
+	requests    int
+	outstanding int
+
+	// served counts the requests the backend served since the sidecar
+	// started, and series its recent samples for the dashboard.
+	served int
+	series []sample
+	// The requests served and latencies observed since the last sample.
+	sampleRequests int
+	latencySum     time.Duration
+	latencyCount   int
+}
+
+// seriesLength is the number of samples kept per backend for the dashboard.
+const seriesLength = 180
+
+// sample is a backend's state at one metrics refresh.
+type sample struct {
+	Time     time.Time `json:"time"`
+	CPU      float64   `json:"cpu"`
+	Memory   float64   `json:"memory"`
+	Network  float64   `json:"network"`
+	Score    float64   `json:"score"`
+	Requests int       `json:"requests"`
+	// LatencyMS is the mean latency of the requests served since the last
+	// sample, or 0 if there were none.
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// addSample records the backend's state at time now and starts a new
+// sample interval. svc.mu must be held.
+func (svc *service) addSample(b *backend, now time.Time) {
+	s := sample{
+		Time:     now,
+		CPU:      b.metrics.CPUUsage,
+		Memory:   b.metrics.MemoryUsage,
+		Network:  b.metrics.NetworkTraffic,
+		Score:    svc.score(b).Total,
+		Requests: b.sampleRequests,
+	}
+	if b.latencyCount > 0 {
+		s.LatencyMS = float64(b.latencySum) / float64(b.latencyCount) / float64(time.Millisecond)
+	}
+	if len(b.series) >= seriesLength {
+		b.series = b.series[1:]
+	}
+	b.series = append(b.series, s)
+	b.sampleRequests = 0
+	b.latencySum, b.latencyCount = 0, 0
+}
+
+// score is the backend's combined load score plus a penalty for its recent
+// failures, so that an idle backend that fails requests is not favored. A
+// higher weight makes a backend look proportionally less loaded.
+func (svc *service) score(b *backend) score {
+	sc := combinedScore(b.metrics, b.history)
+	if svc.outliers != nil {
+		sc = sc.withErrors(svc.outliers.FailureRate(b.Name))
+	}
+	return sc.scale(1 / float64(svc.weight(b)))
+}
+
+// weight is the backend's weight, or the operator's override of it.
+func (svc *service) weight(b *backend) int {
+	if w := svc.override(b.Name).weight; w > 0 {
+		return w
+	}
+	return b.Weight
+}
+
+// current returns the backends reported by the service's source, keeping the
+// state of those that are still present. svc.mu must be held.
+func (svc *service) current() []*backend {
+	var list []*backend
+	next := map[string]*backend{}
+	for _, d := range svc.source.Backends() {
+		b, ok := svc.backends[d.Name]
+		if !ok {
+			b = &backend{}
+		}
+		b.Backend = d
+		next[d.Name] = b
+		list = append(list, b)
+	}
+	svc.backends = next
+	return list
+}
+
+func (svc *service) healthStatus(name string) health.Status {
+	if svc.health == nil {
+		return health.Status{Healthy: true}
+	}
+	return svc.health.Status(name)
+}
+
+// unavailable returns why a backend can't be routed to right now, or "" if
+// it can. An operator's override wins over health checks, outlier detection
+// and circuit breaking.
+func (svc *service) unavailable(name string) string {
+	switch svc.override(name).state {
+	case stateDraining:
+		return "draining"
+	case stateDisabled:
+		return "disabled"
+	case stateEnabled:
+		return ""
+	}
+	switch {
+	case !svc.healthStatus(name).Healthy:
+		return "unhealthy"
+	case svc.ejected(name):
+		return "ejected"
+	case !svc.circuitAllows(name):
+		return "circuit open"
+	}
+	return ""
+}
+
+func (svc *service) ejected(name string) bool {
+	return svc.outliers != nil && svc.outliers.Ejected(name)
+}
+
+func (svc *service) circuitAllows(name string) bool {
+	return svc.circuits == nil || svc.circuits.Allow(name)
+}
+
+// circuitState is the state of the backend's circuit, or empty if circuit
+// breaking is off.
+func (svc *service) circuitState(name string) string {
+	if svc.circuits == nil {
+		return ""
+	}
+	return svc.circuits.Status(name).State
+}
+
+// observe reports the outcome of a request sent to a backend to the
+// service's outlier detector and circuit breakers. latency is 0 if it says
+// nothing about the backend.
+func (svc *service) observe(name string, failed bool, latency time.Duration) {
+	result := "success"
+	if failed {
+		result = "failure"
+	}
+	backendCallsTotal.WithLabelValues(svc.name, name, result).Inc()
+	if latency > 0 {
+		backendCallDuration.WithLabelValues(svc.name, name).Observe(latency.Seconds())
+		svc.mu.Lock()
+		if b, ok := svc.backends[name]; ok {
+			b.latencySum += latency
+			b.latencyCount++
+		}
+		svc.mu.Unlock()
+	}
+	if svc.outliers != nil {
+		svc.outliers.Record(name, failed, latency)
+	}
+	if svc.circuits != nil {
+		svc.circuits.Record(name, failed)
+	}
+}
+
+// notify wakes up everything waiting on watch, after a metrics refresh, a
+// health change or an ejection.
+func (svc *service) notify() {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.notifyLocked()
+}
+
+func (svc *service) notifyLocked() {
+	if svc.changed != nil {
+		close(svc.changed)
+		svc.changed = nil
+	}
+}
+
+// balancer returns the service's balancer for strategy, or for its
+// configured strategy if empty. Balancers keep state such as a round-robin
+// position, so each strategy gets one instance per service.
+func (svc *service) balancer(strategy string) (balancer.Balancer, error) {
+	if strategy == "" {
+		strategy = svc.strategy
+	}
+	svc.balancersMu.Lock()
+	defer svc.balancersMu.Unlock()
+	if b, ok := svc.balancers[strategy]; ok {
+		return b, nil
+	}
+	b, err := balancer.New(strategy, rand.NewSource(time.Now().UnixNano()))
+	if err != nil {
+		return nil, err
+	}
+	svc.balancers[strategy] = b
+	return b, nil
+}
+
+// watch returns channels that are closed the next time the service is
+// notified or its backends change.
+func (svc *service) watch() (metricsChanged, backendsChanged <-chan struct{}) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if svc.changed == nil {
+		svc.changed = make(chan struct{})
+	}
+	return svc.changed, svc.source.Changed()
+}
+
+// refreshMetrics fetches the metrics of every service of snap on its
+// metrics_interval until snap is retired, so that routing never waits on the
+// metrics source.
+func (s *SidecarServer) refreshMetrics(snap *snapshot) {
+	ticker := time.NewTicker(snap.cfg.MetricsInterval)
+	defer ticker.Stop()
+	for {
+		for _, svc := range snap.services {
+			s.refreshService(snap.cfg, svc)
+		}
+		select {
+		case <-snap.retired:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshService stores one sample per backend. If the source fails, or has
+// no sample for a backend, the previous sample is kept and no history is
+// recorded.
+func (s *SidecarServer) refreshService(cfg *config.Config, svc *service) {
+	backends := svc.source.Backends()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.MetricsInterval)
+	defer cancel()
+	ctx, span := s.tracer.Start(ctx, "metrics refresh", trace.WithAttributes(
+		attribute.String("sidecar.service", svc.name),
+		attribute.String("sidecar.metrics_source", svc.metricsSource),
+		attribute.Int("sidecar.backends", len(backends)),
+	))
+	defer span.End()
+	start := time.Now()
+	samples, err := svc.metrics.Metrics(ctx, backends)
+	metricsRefreshDuration.WithLabelValues(svc.name, svc.metricsSource).Observe(time.Since(start).Seconds())
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		metricsRefreshErrors.WithLabelValues(svc.name, svc.metricsSource).Inc()
+		slog.Warn("failed to refresh metrics", "service", svc.name, "source", svc.metricsSource, "error", err)
+		svc.mu.Lock()
+		svc.metricsFailures++
+		svc.notifyLocked()
+		svc.mu.Unlock()
+		return
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	svc.metricsFailures = 0
+	var names []string
+	now := time.Now()
+	for _, b := range svc.current() {
+		names = append(names, b.Name)
+		if m, ok := samples[b.Name]; ok {
+			b.metrics = m
+			if len(b.history) >= cfg.MaxHistory {
+				b.history = b.history[1:]
+			}
+			b.history = append(b.history, m)
+		}
+		svc.addSample(b, now)
+	}
+	if svc.circuits != nil {
+		svc.circuits.Retain(names)
+	}
+	svc.notifyLocked()
+}
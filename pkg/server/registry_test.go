@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"try/pkg/config"
+	"try/pkg/discovery"
+	"try/pkg/metrics"
+)
+
+// fixedMetrics is a metrics source that returns its samples.
+type fixedMetrics map[string]metrics.BackendMetrics
+
+func (f fixedMetrics) Metrics(context.Context, []discovery.Backend) (map[string]metrics.BackendMetrics, error) {
+	return f, nil
+}
+
+func TestRefreshKeepsMissingSamples(t *testing.T) {
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+services:
+  - name: cart
+    backends:
+      - name: cart-1
+        address: 127.0.0.1
+        port: 1
+`)
+	samples := fixedMetrics{
+		"cart-1": {CPUUsage: 40, MemoryUsage: 30},
+		"cart-2": {CPUUsage: 60, MemoryUsage: 50},
+	}
+	svc := &service{
+		name: "cart",
+		source: discovery.Static([]config.Backend{
+			{Name: "cart-1", Address: "127.0.0.1", Port: 1},
+			{Name: "cart-2", Address: "127.0.0.1", Port: 2},
+		}),
+		metrics:       samples,
+		metricsSource: "test",
+		backends:      map[string]*backend{},
+	}
+	cfg := s.snapshot().cfg
+	s.refreshService(cfg, svc)
+
+	// cart-2 is missing from the next result.
+	delete(samples, "cart-2")
+	samples["cart-1"] = metrics.BackendMetrics{CPUUsage: 20, MemoryUsage: 10}
+	s.refreshService(cfg, svc)
+
+	one, two := svc.backends["cart-1"], svc.backends["cart-2"]
+	if len(one.history) != 2 || one.metrics.CPUUsage != 20 {
+		t.Errorf("cart-1: metrics %+v, %d in history; want the new sample and 2", one.metrics, len(one.history))
+	}
+	if two.metrics.CPUUsage != 60 || two.metrics.MemoryUsage != 50 {
+		t.Errorf("cart-2 metrics = %+v, want the previous sample", two.metrics)
+	}
+	if len(two.history) != 1 {
+		t.Errorf("cart-2 has %d samples in history, want 1", len(two.history))
+	}
+}
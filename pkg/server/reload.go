@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"try/pkg/auth"
+	"try/pkg/balancer"
+	"try/pkg/circuit"
+	"try/pkg/config"
+	"try/pkg/discovery"
+	"try/pkg/health"
+	"try/pkg/logging"
+	"try/pkg/metrics"
+	"try/pkg/outlier"
+)
+
+// snapshot is a configuration and the services built from it. Reload
+// replaces it as a whole: requests in flight complete against the snapshot
+// they started with, new ones use the new snapshot.
+type snapshot struct {
+	cfg      *config.Config
+	services map[string]*service
+	// decisionSampler picks the successful routing decisions that are
+	// logged.
+	decisionSampler logging.Sampler
+	// retired is closed when the snapshot is replaced or the server closes,
+	// stopping its background work.
+	retired chan struct{}
+	// auth is nil if callers don't have to authenticate.
+	auth *auth.Authenticator
+}
+
+func (s *SidecarServer) snapshot() *snapshot {
+	return s.snap.Load()
+}
+
+// selectServices returns the service called name, or every service in
+// config order if name is empty. ok is false if there is no such service.
+func (snap *snapshot) selectServices(name string) (services []*service, ok bool) {
+	if name != "" {
+		svc, ok := snap.services[name]
+		if !ok {
+			return nil, false
+		}
+		return []*service{svc}, true
+	}
+	for _, sc := range snap.cfg.Services {
+		services = append(services, snap.services[sc.Name])
+	}
+	return services, true
+}
+
+// build creates the services of cfg. Services that are also in prev keep
+// their backends' metrics and samples and the operators' overrides, and, if
+// their configuration is unchanged, their discovery, health, outlier and
+// circuit state.
+func (s *SidecarServer) build(cfg *config.Config, prev *snapshot) (*snapshot, error) {
+	snap := &snapshot{
+		cfg:             cfg,
+		services:        map[string]*service{},
+		decisionSampler: logging.Sampler(cfg.Log.DecisionSampleRate),
+		retired:         make(chan struct{}),
+	}
+	if cfg.Auth.Enabled() {
+		a, err := auth.New(cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		snap.auth = a
+		if !cfg.TLS.Enabled() {
+			slog.Warn("auth is on without tls, so bearer tokens cross the network in the clear")
+		}
+	}
+	prom := metrics.NewPrometheus(cfg.PrometheusURL)
+
+	for _, sc := range cfg.Services {
+		svc := &service{
+			name:          sc.Name,
+			strategy:      sc.Balancer,
+			mode:          sc.Mode,
+			decisionHold:  *sc.DecisionHold,
+			probe:         sc.Probe,
+			proxy:         sc.Proxy,
+			retry:         sc.Retry,
+			retryBudget:   newRetryBudget(sc.Retry),
+			metricsSource: sc.Metrics.Source,
+			balancers:     map[string]balancer.Balancer{},
+			overrides:     map[string]override{},
+			backends:      map[string]*backend{},
+			retired:       snap.retired,
+		}
+		if prevSC, ok := prev.serviceConfig(sc.Name); ok && reflect.DeepEqual(*prevSC, sc) {
+			old := prev.services[sc.Name]
+			svc.source, svc.health, svc.outliers, svc.circuits, svc.checks = old.source, old.health, old.outliers, old.circuits, old.checks
+		} else if err := s.buildChecks(svc, sc); err != nil {
+			return nil, err
+		}
+		switch sc.Metrics.Source {
+		case config.MetricsMetricsServer:
+			if s.metricsClient == nil {
+				return nil, fmt.Errorf("service %q uses metrics-server but no metrics client was configured", sc.Name)
+			}
+			svc.metrics = metrics.NewMetricsServer(s.metricsClient, sc.Metrics.Namespace)
+		default:
+			svc.metrics = prom
+		}
+		if prev != nil {
+			if old, ok := prev.services[sc.Name]; ok {
+				svc.inherit(old, cfg.MaxHistory)
+			}
+		}
+		snap.services[sc.Name] = svc
+	}
+	return snap, nil
+}
+
+// buildChecks creates the discovery source, health monitor, outlier
+// detector and circuit breakers of svc.
+func (s *SidecarServer) buildChecks(svc *service, sc config.Service) error {
+	svc.checks = &checks{stop: make(chan struct{})}
+	if k := sc.Kubernetes; k != nil {
+		if s.watcher == nil {
+			return fmt.Errorf("service %q uses kubernetes discovery but no Kubernetes client was configured", sc.Name)
+		}
+		svc.source = s.watcher.Watch(k.Namespace, k.Service, k.PortName)
+	} else {
+		svc.source = discovery.Static(sc.Backends)
+	}
+	if sc.HealthCheck.Type != "" {
+		checker, err := health.NewChecker(sc.HealthCheck)
+		if err != nil {
+			return fmt.Errorf("service %q: %w", sc.Name, err)
+		}
+		svc.health = health.NewMonitor(sc.Name, svc.source, checker, sc.HealthCheck)
+		svc.health.OnChange = svc.checks.notify
+	}
+	if sc.OutlierDetection.Enabled {
+		svc.outliers = outlier.NewDetector(sc.Name, svc.source, sc.OutlierDetection)
+		svc.outliers.OnChange = svc.checks.notify
+	}
+	if sc.CircuitBreaker.Enabled {
+		svc.circuits = circuit.NewBreakers(sc.Name, sc.CircuitBreaker)
+		svc.circuits.OnChange = svc.checks.notify
+	}
+	return nil
+}
+
+// serviceConfig returns the configuration of the service called name, if
+// snap has one; snap may be nil.
+func (snap *snapshot) serviceConfig(name string) (*config.Service, bool) {
+	if snap == nil {
+		return nil, false
+	}
+	return snap.cfg.Service(name)
+}
+
+// stopChecks stops the health checking and outlier analysis of the services
+// of snap that next no longer uses, or all of them if next is nil.
+func (snap *snapshot) stopChecks(next *snapshot) {
+	for name, svc := range snap.services {
+		if next != nil {
+			if n, ok := next.services[name]; ok && n.checks == svc.checks {
+				continue
+			}
+		}
+		close(svc.checks.stop)
+	}
+}
+
+// inherit carries the backends' metrics, samples and request counts, the
+// failed metrics refreshes and the operators' overrides over from the
+// service svc replaces. Requests still in
+// flight on old are not counted as outstanding on svc.
+func (svc *service) inherit(old *service, maxHistory int) {
+	old.mu.Lock()
+	svc.metricsFailures = old.metricsFailures
+	for name, b := range old.backends {
+		history := b.history
+		if len(history) > maxHistory {
+			history = history[len(history)-maxHistory:]
+		}
+		svc.backends[name] = &backend{
+			metrics:        b.metrics,
+			history:        append([]metrics.BackendMetrics(nil), history...),
+			requests:       b.requests,
+			served:         b.served,
+			series:         append([]sample(nil), b.series...),
+			sampleRequests: b.sampleRequests,
+			latencySum:     b.latencySum,
+			latencyCount:   b.latencyCount,
+		}
+	}
+	old.mu.Unlock()
+
+	old.overridesMu.Lock()
+	for name, o := range old.overrides {
+		svc.overrides[name] = o
+	}
+	old.overridesMu.Unlock()
+}
+
+// start runs the background work of snap until it is retired.
+func (s *SidecarServer) start(snap *snapshot) {
+	go s.refreshMetrics(snap)
+	for _, svc := range snap.services {
+		go s.publishServiceUpdates(svc, snap.retired)
+		svc.checks.owner.Store(svc)
+		svc.checks.startOnce.Do(func() {
+			if svc.health != nil {
+				go svc.health.Run(svc.checks.stop)
+			}
+			if svc.outliers != nil {
+				go svc.outliers.Run(svc.checks.stop)
+			}
+		})
+	}
+}
+
+// syncDiscovery starts the informers of newly watched Kubernetes Services
+// and waits a while for their first list.
+func (s *SidecarServer) syncDiscovery() {
+	if s.watcher == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s.watcher.Start(ctx); err != nil {
+		// Keep going: the informers continue in the background and the
+		// backend sets fill in once the API server answers.
+		slog.Warn("Kubernetes discovery has not synced yet", "error", err)
+	}
+}
+
+// retainWatches stops discovery for the Kubernetes Services that no
+// service of snap uses any more.
+func (s *SidecarServer) retainWatches(snap *snapshot) {
+	if s.watcher == nil {
+		return
+	}
+	var sets []*discovery.BackendSet
+	for _, svc := range snap.services {
+		if set, ok := svc.source.(*discovery.BackendSet); ok {
+			sets = append(sets, set)
+		}
+	}
+	s.watcher.Retain(sets)
+}
+
+// Reload replaces the configuration in effect with cfg, which must be
+// valid. Services, backends, balancers, metric sources, routes, auth and log
+// settings change at once; listen addresses, the admin API, tracing, TLS
+// settings and enabling the gRPC proxy only change on restart. If cfg can't
+// be applied, the current configuration stays.
+func (s *SidecarServer) Reload(cfg *config.Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	select {
+	case <-s.stop:
+		return fmt.Errorf("sidecar is closed")
+	default:
+	}
+
+	old := s.snapshot()
+	snap, err := s.build(cfg, old)
+	if err == nil && cfg.Log != old.cfg.Log {
+		err = logging.Setup(cfg.Log)
+	}
+	if err != nil {
+		// Drop the Services the failed build started watching.
+		s.retainWatches(old)
+		return err
+	}
+	s.syncDiscovery()
+	s.snap.Store(snap)
+	close(old.retired)
+	old.stopChecks(snap)
+	s.retainWatches(snap)
+	s.start(snap)
+
+	for _, field := range restartOnlyChanges(old.cfg, cfg) {
+		slog.Warn("config change takes effect after a restart", "field", field)
+	}
+	slog.Info("configuration reloaded", "services", len(cfg.Services))
+	return nil
+}
+
+// restartOnlyChanges returns the settings that differ between old and cfg
+// but that Reload can't change.
+func restartOnlyChanges(old, cfg *config.Config) []string {
+	var fields []string
+	check := func(field string, changed bool) {
+		if changed {
+			fields = append(fields, field)
+		}
+	}
+	check("listen", old.Listen != cfg.Listen)
+	check("graph_listen", old.GraphListen != cfg.GraphListen)
+	check("metrics_listen", old.MetricsListen != cfg.MetricsListen)
+	check("http_proxy.listen", old.HTTPProxy.Listen != cfg.HTTPProxy.Listen)
+	check("grpc_proxy.enabled", old.GRPCProxy.Enabled != cfg.GRPCProxy.Enabled)
+	check("admin", old.Admin != cfg.Admin)
+	check("tracing", old.Tracing != cfg.Tracing)
+	check("tls", old.TLS != cfg.TLS)
+	return fields
+}
+
+// WatchConfig reloads the configuration from path on SIGHUP and, if
+// interval is not 0, whenever the file's contents change, checked every
+// interval. An invalid configuration is logged and the current one kept. It
+// returns once the server is closed.
+func (s *SidecarServer) WatchConfig(path string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var last []byte
+	if data, err := os.ReadFile(path); err == nil {
+		sum := sha256.Sum256(data)
+		last = sum[:]
+	}
+
+	for {
+		// SIGHUP reloads even an unchanged file; polling only a changed one,
+		// and waits out a file that is briefly missing while being replaced.
+		hangup := false
+		select {
+		case <-s.stop:
+			return
+		case <-hup:
+			hangup = true
+			slog.Info("reloading configuration on SIGHUP", "path", path)
+		case <-tick:
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if hangup {
+				slog.Error("rejected configuration, keeping the current one", "path", path, "error", err)
+			}
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if !hangup && bytes.Equal(sum[:], last) {
+			continue
+		}
+		last = sum[:]
+
+		cfg, err := config.Parse(data)
+		if err != nil {
+			slog.Error("rejected configuration, keeping the current one", "path", path, "error", err)
+			continue
+		}
+		if err := s.Reload(cfg); err != nil {
+			slog.Error("rejected configuration, keeping the current one", "path", path, "error", err)
+		}
+	}
+}
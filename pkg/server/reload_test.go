@@ -0,0 +1,196 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"try/pkg/config"
+
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReloadKeepsCheckStateOfUnchangedServices(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	upHost, upPort := backendAddr(t, up)
+	downHost, downPort := backendAddr(t, down)
+
+	cartSection := fmt.Sprintf(`
+  - name: cart
+    health_check:
+      type: http
+      interval: 1h
+      unhealthy_threshold: 1
+    outlier_detection:
+      enabled: true
+    circuit_breaker:
+      enabled: true
+      consecutive_failures: 1
+      open_duration: 1h
+    backends:
+      - name: cart-1
+        address: %s
+        port: %s
+      - name: cart-2
+        address: %s
+        port: %s
+`, upHost, upPort, downHost, downPort)
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+services:`+cartSection)
+	reload := func(yaml string) *service {
+		t.Helper()
+		cfg, err := config.Parse([]byte("prometheus_url: " + s.snapshot().cfg.PrometheusURL + "\n" + yaml))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Reload(cfg); err != nil {
+			t.Fatal(err)
+		}
+		return s.snapshot().services["cart"]
+	}
+
+	cart := s.snapshot().services["cart"]
+	deadline := time.Now().Add(5 * time.Second)
+	for cart.healthStatus("cart-2").Healthy {
+		if time.Now().After(deadline) {
+			t.Fatal("cart-2 never turned unhealthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cart.circuits.Record("cart-1", true)
+	if cart.circuitAllows("cart-1") {
+		t.Fatal("cart-1's circuit did not open")
+	}
+
+	// Adding a service leaves cart's section as it was.
+	next := reload(`services:` + cartSection + `
+  - name: orders
+    backends:
+      - name: orders-1
+        address: 127.0.0.1
+        port: 1
+`)
+	if next == cart {
+		t.Fatal("reload kept the service itself")
+	}
+	if next.health != cart.health || next.outliers != cart.outliers || next.circuits != cart.circuits || next.source != cart.source {
+		t.Fatal("reload replaced the checks of an unchanged service")
+	}
+	if next.checks.owner.Load() != next {
+		t.Error("changes are not passed on to the new service")
+	}
+	if next.healthStatus("cart-2").Healthy {
+		t.Error("cart-2 came back healthy after the reload")
+	}
+	if next.circuitAllows("cart-1") {
+		t.Error("cart-1's circuit closed after the reload")
+	}
+	select {
+	case <-cart.checks.stop:
+		t.Fatal("reload stopped the checks it kept")
+	default:
+	}
+
+	// Changing the section starts over.
+	changed := reload(`services:` + cartSection + `    retry:
+      max_attempts: 1
+`)
+	if changed.health == next.health || changed.circuits == next.circuits {
+		t.Fatal("reload kept the checks of a changed service")
+	}
+	if !changed.circuitAllows("cart-1") {
+		t.Error("cart-1's circuit is open on a new breaker")
+	}
+	select {
+	case <-next.checks.stop:
+	default:
+		t.Error("reload did not stop the checks it replaced")
+	}
+}
+
+func TestReloadStopsUnusedDiscovery(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var mu sync.Mutex
+	watches := map[string]*watch.FakeWatcher{}
+	client.PrependWatchReactor("endpointslices", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fw := watch.NewFake()
+		watches[action.GetNamespace()] = fw
+		return true, fw, nil
+	})
+	// open waits a while for the watch of namespace to be open or stopped,
+	// as want says, and reports whether it is open.
+	open := func(namespace string, want bool) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			fw := watches[namespace]
+			mu.Unlock()
+			got := fw != nil && !fw.IsStopped()
+			if got == want || time.Now().After(deadline) {
+				return got
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+services:
+  - name: cart
+    kubernetes:
+      namespace: shop
+`, WithKubernetesClient(client))
+	reload := func(yaml string) {
+		t.Helper()
+		cfg, err := config.Parse([]byte("prometheus_url: " + s.snapshot().cfg.PrometheusURL + "\n" + yaml))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Reload(cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !open("shop", true) {
+		t.Fatal("cart's EndpointSlices are not watched")
+	}
+
+	// Moving the service to another namespace watches that one instead.
+	reload(`
+services:
+  - name: cart
+    kubernetes:
+      namespace: store
+`)
+	if !open("store", true) {
+		t.Fatal("cart's new namespace is not watched")
+	}
+	if open("shop", false) {
+		t.Error("cart's old namespace is still watched")
+	}
+
+	// Removing the service stops its watch.
+	reload(`
+services:
+  - name: orders
+    backends:
+      - name: orders-1
+        address: 127.0.0.1
+        port: 1
+`)
+	if open("store", false) {
+		t.Error("the removed service is still watched")
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"try/pkg/config"
+	pb "try/pkg/grpcapi"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// retryBudgetWindow is the span of traffic a retry budget is a share of.
+const retryBudgetWindow = 10 * time.Second
+
+// retryBudget limits a service's retries to a share of its requests, so that
+// retries cannot multiply the load on backends that are already failing.
+// Requests and retries are counted in the current and the previous window.
+type retryBudget struct {
+	percent    int
+	minRetries int
+
+	mu                        sync.Mutex
+	start                     time.Time
+	requests, retries         int
+	prevRequests, prevRetries int
+}
+
+func newRetryBudget(cfg config.Retry) *retryBudget {
+	return &retryBudget{percent: *cfg.BudgetPercent, minRetries: *cfg.MinRetries}
+}
+
+// rotate starts a new window if the current one is over. b.mu must be held.
+func (b *retryBudget) rotate(now time.Time) {
+	if now.Sub(b.start) < retryBudgetWindow {
+		return
+	}
+	b.prevRequests, b.prevRetries = b.requests, b.retries
+	if now.Sub(b.start) >= 2*retryBudgetWindow {
+		b.prevRequests, b.prevRetries = 0, 0
+	}
+	b.requests, b.retries = 0, 0
+	b.start = now
+}
+
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(time.Now())
+	b.requests++
+}
+
+// allowRetry reports whether the budget has room for one more retry and, if
+// so, spends it.
+func (b *retryBudget) allowRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rotate(time.Now())
+	allowed := (b.requests + b.prevRequests) * b.percent / 100
+	if allowed < b.minRetries {
+		allowed = b.minRetries
+	}
+	if b.retries+b.prevRetries >= allowed {
+		return false
+	}
+	b.retries++
+	return true
+}
+
+// backendCall sends one attempt of a probe or proxied request to c.
+type backendCall func(ctx context.Context, c candidate) (*backendResult, error)
+
+// callWithRetries sends the request to selected and, while it fails in a
+// retryable way, to the fallbacks in order, skipping those that became
+// unavailable since they were ranked. It returns the backend that answered
+// the last attempt with its result, every attempt made and the last
+// attempt's error.
+func (s *SidecarServer) callWithRetries(ctx context.Context, svc *service, selected candidate, fallbacks []candidate, call backendCall) (candidate, *backendResult, []*pb.Attempt, error) {
+	policy := svc.retry
+	svc.retryBudget.request()
+
+	var attempts []*pb.Attempt
+	c := selected
+	next := fallbacks
+	for {
+		result, err := s.attempt(ctx, svc, c, len(attempts)+1, call)
+		if c.backend != selected.backend {
+			s.release(svc, c)
+		}
+		attempt := &pb.Attempt{BackendName: c.Name, Url: c.URL()}
+		if result != nil {
+			attempt.StatusCode = int32(result.statusCode)
+			attempt.Latency = durationpb.New(result.latency)
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		attempts = append(attempts, attempt)
+
+		if !retryable(policy, result, err) || len(attempts) >= policy.MaxAttempts {
+			return c, result, attempts, err
+		}
+		for len(next) > 0 && svc.unavailable(next[0].Name) != "" {
+			next = next[1:]
+		}
+		if len(next) == 0 || !svc.retryBudget.allowRetry() {
+			return c, result, attempts, err
+		}
+		if err := sleepCtx(ctx, backoff(policy, len(attempts))); err != nil {
+			return c, result, attempts, err
+		}
+		c, next = s.acquire(svc, next[0]), next[1:]
+		slog.Info("retrying request", "service", svc.name, "backend", c.Name,
+			"attempt", len(attempts)+1, "max_attempts", policy.MaxAttempts,
+			"previous_status", attempts[len(attempts)-1].StatusCode, "previous_error", attempts[len(attempts)-1].Error)
+	}
+}
+
+// attempt makes call number n to c under the per-try timeout, in a span of
+// its own, and reports its outcome to outlier detection. If the caller's
+// context ends first, it returns the caller's cancellation or deadline,
+// which says nothing about the backend and is not retried.
+func (s *SidecarServer) attempt(ctx context.Context, svc *service, c candidate, n int, call backendCall) (*backendResult, error) {
+	callerCtx := ctx
+	ctx, span := s.startBackendSpan(ctx, svc, c, n)
+	if svc.retry.PerTryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, svc.retry.PerTryTimeout)
+		defer cancel()
+	}
+	result, err := call(ctx, c)
+	if err != nil && callerCtx.Err() != nil {
+		err = status.FromContextError(callerCtx.Err()).Err()
+		endBackendSpan(span, 0, err)
+		return nil, err
+	}
+	if result != nil || backendFailed(nil, err) {
+		svc.observe(c.Name, backendFailed(result, err), result.observedLatency())
+	}
+	statusCode := 0
+	if result != nil {
+		statusCode = result.statusCode
+	}
+	endBackendSpan(span, statusCode, err)
+	return result, err
+}
+
+// attemptsError is the error of a failed RouteRequest: the last attempt's
+// error, noting how many were made, with every attempt as a status detail.
+func attemptsError(err error, last candidate, attempts []*pb.Attempt) error {
+	st := status.Convert(err)
+	if len(attempts) > 1 {
+		st = status.Newf(st.Code(), "%d attempts failed, last on %s: %s", len(attempts), last.Name, st.Message())
+	}
+	details := make([]protoadapt.MessageV1, len(attempts))
+	for i, a := range attempts {
+		details[i] = a
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// retryable reports whether an attempt failed in a way another backend may
+// not: the backend was unreachable or timed out, or answered with one of the
+// policy's status codes.
+func retryable(policy config.Retry, result *backendResult, err error) bool {
+	if result != nil {
+		for _, code := range policy.RetryableStatusCodes {
+			if result.statusCode == code {
+				return true
+			}
+		}
+	}
+	return status.Code(err) == codes.Unavailable
+}
+
+// backoff returns a random delay of up to BackoffBase doubled for each retry
+// already made, capped at BackoffMax.
+func backoff(policy config.Retry, retry int) time.Duration {
+	d := policy.BackoffBase
+	for i := 1; i < retry && d < policy.BackoffMax; i++ {
+		d *= 2
+	}
+	if d > policy.BackoffMax {
+		d = policy.BackoffMax
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "try/pkg/grpcapi"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallerDeadlineIsNotABackendFailure(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	host, port := backendAddr(t, slow)
+
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+services:
+  - name: cart
+    mode: probe
+    outlier_detection:
+      enabled: true
+      consecutive_errors: 3
+      max_ejection_percent: 100
+    circuit_breaker:
+      enabled: true
+      consecutive_failures: 3
+      open_duration: 1h
+    backends:
+      - name: cart-1
+        address: `+host+`
+        port: `+port+`
+`)
+	client := dial(t, s)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		_, err := client.RouteRequest(ctx, &pb.RouteRequestRequest{ServiceName: "cart"})
+		cancel()
+		if status.Code(err) != codes.DeadlineExceeded {
+			t.Fatalf("impatient call %d: %v, want DeadlineExceeded", i, err)
+		}
+	}
+	// Let the sidecar finish the calls the callers gave up on.
+	time.Sleep(100 * time.Millisecond)
+
+	svc := s.snapshot().services["cart"]
+	if why := svc.unavailable("cart-1"); why != "" {
+		t.Errorf("cart-1 is %s after callers gave up on it", why)
+	}
+	if rate := svc.outliers.FailureRate("cart-1"); rate != 0 {
+		t.Errorf("cart-1 failure rate = %v, want 0", rate)
+	}
+	if _, err := client.RouteRequest(context.Background(), &pb.RouteRequestRequest{ServiceName: "cart"}); err != nil {
+		t.Fatalf("patient call: %v", err)
+	}
+}
+
+// retryService starts a sidecar whose cart service probes the given
+// backends, named cart-1, cart-2, ... in order, with the retry section
+// retry.
+func retryService(t *testing.T, retry string, addrs ...string) pb.SidecarServiceClient {
+	t.Helper()
+	var backends strings.Builder
+	for i, addr := range addrs {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&backends, "      - name: cart-%d\n        address: %s\n        port: %s\n", i+1, host, port)
+	}
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+services:
+  - name: cart
+    mode: probe
+    retry:
+`+retry+`
+    backends:
+`+backends.String())
+	return dial(t, s)
+}
+
+// statusBackend answers every request with code and returns its address.
+func statusBackend(t *testing.T, code int) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// attemptsOf returns the attempts of a RouteRequest from its response or,
+// if it failed, from its status details.
+func attemptsOf(t *testing.T, resp *pb.RouteResponse, err error) []*pb.Attempt {
+	t.Helper()
+	if err == nil {
+		return resp.Attempts
+	}
+	var attempts []*pb.Attempt
+	for _, detail := range status.Convert(err).Details() {
+		a, ok := detail.(*pb.Attempt)
+		if !ok {
+			t.Fatalf("unexpected status detail %T", detail)
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		retry string
+		// backends are HTTP status codes, or 0 for a closed port.
+		backends []int
+		attempts int
+		code     codes.Code
+	}{
+		{"each backend once", "      max_attempts: 5", []int{0, 0, 0}, 3, codes.Unavailable},
+		{"max attempts", "      max_attempts: 2", []int{0, 0, 0}, 2, codes.Unavailable},
+		{"disabled", "      max_attempts: 1", []int{0, 0}, 1, codes.Unavailable},
+		{"retryable status", "      max_attempts: 3", []int{503, 503}, 2, codes.OK},
+		{"other status", "      max_attempts: 3", []int{500, 500}, 1, codes.OK},
+		{"configured status", "      retryable_status_codes: [500]", []int{500, 500}, 2, codes.OK},
+		{"no budget", "      budget_percent: 0\n      min_retries: 0", []int{0, 0, 0}, 1, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var addrs []string
+			for _, code := range tt.backends {
+				if code == 0 {
+					addrs = append(addrs, freeAddr(t))
+				} else {
+					addrs = append(addrs, statusBackend(t, code))
+				}
+			}
+			client := retryService(t, tt.retry, addrs...)
+
+			resp, err := client.RouteRequest(context.Background(), &pb.RouteRequestRequest{ServiceName: "cart"})
+			if status.Code(err) != tt.code {
+				t.Fatalf("RouteRequest: %v, want %v", err, tt.code)
+			}
+			attempts := attemptsOf(t, resp, err)
+			if len(attempts) != tt.attempts {
+				t.Fatalf("%d attempts, want %d: %v", len(attempts), tt.attempts, attempts)
+			}
+			tried := map[string]bool{}
+			for _, a := range attempts {
+				if tried[a.BackendName] {
+					t.Errorf("%s tried twice", a.BackendName)
+				}
+				tried[a.BackendName] = true
+			}
+		})
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	client := retryService(t, "      budget_percent: 0\n      min_retries: 1", freeAddr(t), freeAddr(t))
+	for i, want := range []int{2, 1, 1} {
+		_, err := client.RouteRequest(context.Background(), &pb.RouteRequestRequest{ServiceName: "cart"})
+		if got := len(attemptsOf(t, nil, err)); got != want {
+			t.Errorf("request %d: %d attempts, want %d", i+1, got, want)
+		}
+	}
+}
+
+func TestPerTryTimeout(t *testing.T) {
+	slow := func() string {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}))
+		t.Cleanup(srv.Close)
+		return strings.TrimPrefix(srv.URL, "http://")
+	}
+	client := retryService(t, "      per_try_timeout: 50ms", slow(), slow())
+
+	start := time.Now()
+	_, err := client.RouteRequest(context.Background(), &pb.RouteRequestRequest{ServiceName: "cart"})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("RouteRequest: %v, want Unavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("took %v, longer than two 50ms tries", elapsed)
+	}
+	attempts := attemptsOf(t, nil, err)
+	if len(attempts) != 2 {
+		t.Fatalf("%d attempts, want 2", len(attempts))
+	}
+	for _, a := range attempts {
+		if !strings.Contains(a.Error, "deadline exceeded") {
+			t.Errorf("attempt on %s: %q, want a timeout", a.BackendName, a.Error)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Serve runs grpcServer on lis, along with the dashboard, metrics, admin and
+// HTTP proxy servers the configuration enables, until ctx is done or the gRPC
+// or HTTP proxy server, which carry the traffic, fails.
+// It then shuts everything down gracefully and returns the failure, if any.
+func (s *SidecarServer) Serve(ctx context.Context, grpcServer *grpc.Server, lis net.Listener) error {
+	cfg := s.snapshot().cfg
+	var admin http.Handler
+	if cfg.Admin.Listen != "" {
+		var err error
+		if admin, err = s.AdminHandler(); err != nil {
+			return err
+		}
+	}
+
+	graphMux := http.NewServeMux()
+	s.serveDashboard(graphMux)
+	s.serveHTTP("live graph", cfg.GraphListen, graphMux, false)
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", s.MetricsHandler())
+	s.serveHealth(metricsMux)
+	s.serveHTTP("metrics", cfg.MetricsListen, metricsMux, false)
+	if admin != nil {
+		s.serveHTTP("admin API", cfg.Admin.Listen, admin, false)
+	}
+	if cfg.HTTPProxy.Listen != "" {
+		s.serveHTTP("HTTP proxy", cfg.HTTPProxy.Listen, s.HTTPProxy(), true)
+	}
+	go func() {
+		slog.Info("sidecar gRPC server is running", "addr", lis.Addr().String())
+		if err := grpcServer.Serve(lis); err != nil {
+			s.fail(fmt.Errorf("gRPC server: %w", err))
+		}
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("shutting down")
+	case err = <-s.serveErrs:
+		slog.Error("server failed, shutting down", "error", err)
+	}
+	s.shutdown(grpcServer)
+	return err
+}
+
+// serveHTTP serves h on addr until shutdown. If the server fails, Serve
+// shuts down if it is on the data path, and otherwise carries on without it.
+// It does nothing once the listeners are closing.
+func (s *SidecarServer) serveHTTP(name, addr string, h http.Handler, dataPath bool) {
+	srv := &http.Server{Addr: addr, Handler: h}
+	s.serversMu.Lock()
+	defer s.serversMu.Unlock()
+	select {
+	case <-s.draining:
+		return
+	default:
+	}
+	s.servers = append(s.servers, srv)
+	go func() {
+		slog.Info("serving "+name, "addr", addr)
+		err := srv.ListenAndServe()
+		switch {
+		case errors.Is(err, http.ErrServerClosed):
+		case dataPath:
+			s.fail(fmt.Errorf("%s server: %w", name, err))
+		default:
+			slog.Error(name+" server failed, serving without it", "addr", addr, "error", err)
+		}
+	}()
+}
+
+// fail reports a server that stopped on its own. Only the first failure
+// matters: it is the one that makes Serve shut down.
+func (s *SidecarServer) fail(err error) {
+	select {
+	case s.serveErrs <- err:
+	default:
+	}
+}
+
+// drain closes the listeners to new servers and ends the WatchBackends and
+// /events streams, which would otherwise hold up a graceful stop.
+func (s *SidecarServer) drain() {
+	s.drainOnce.Do(func() {
+		s.serversMu.Lock()
+		close(s.draining)
+		s.serversMu.Unlock()
+	})
+}
+
+// shutdown fails readiness, waits out the configured delay, then stops
+// grpcServer and the HTTP servers, giving the requests in flight until the
+// timeout to finish.
+func (s *SidecarServer) shutdown(grpcServer *grpc.Server) {
+	cfg := s.snapshot().cfg.Shutdown
+	close(s.shuttingDown)
+	if cfg.Delay > 0 {
+		slog.Info("readiness is failing, waiting before closing the listeners", "delay", cfg.Delay)
+		time.Sleep(cfg.Delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	s.drain()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			slog.Warn("gRPC calls still in flight at the shutdown timeout, cancelling them")
+			grpcServer.Stop()
+		}
+	}()
+	s.serversMu.Lock()
+	servers := s.servers
+	s.serversMu.Unlock()
+	for _, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				slog.Warn("HTTP requests still in flight at the shutdown timeout, closing them", "addr", srv.Addr, "error", err)
+				srv.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	slog.Info("stopped", "drain_time", time.Since(start))
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// freeAddr returns a loopback address with a port that was free a moment
+// ago.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+// serve runs s.Serve in the background and returns a function that stops
+// it and returns its error.
+func serve(t *testing.T, s *SidecarServer) func() error {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, grpc.NewServer(s.GRPCServerOptions()...), lis) }()
+	return func() error {
+		cancel()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatal("Serve did not return")
+			return nil
+		}
+	}
+}
+
+// waitForStatus polls url until it answers with want.
+func waitForStatus(t *testing.T, url string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == want {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET %s: %v, want %d", url, err, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServeStartsDashboard(t *testing.T) {
+	graph := freeAddr(t)
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+graph_listen: `+graph+`
+metrics_listen: `+freeAddr(t)+`
+services:
+  - name: cart
+    backends:
+      - name: cart-1
+        address: 127.0.0.1
+        port: 1
+`)
+	stop := serve(t, s)
+
+	// No RouteRequest has arrived yet.
+	waitForStatus(t, "http://"+graph+"/graph/", http.StatusOK)
+	waitForStatus(t, "http://"+graph+"/data", http.StatusOK)
+
+	if err := stop(); err != nil {
+		t.Fatalf("Serve returned %v", err)
+	}
+}
+
+// occupy listens on a free loopback port for the rest of the test.
+func occupy(t *testing.T) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lis.Close() })
+	return lis.Addr().String()
+}
+
+func TestServeOutlivesAuxiliaryFailures(t *testing.T) {
+	metricsAddr := freeAddr(t)
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+graph_listen: `+occupy(t)+`
+metrics_listen: `+metricsAddr+`
+admin:
+  listen: `+occupy(t)+`
+  token: secret
+services:
+  - name: cart
+    backends:
+      - name: cart-1
+        address: 127.0.0.1
+        port: 1
+`)
+	stop := serve(t, s)
+	waitForStatus(t, "http://"+metricsAddr+"/healthz", http.StatusOK)
+	select {
+	case err := <-s.serveErrs:
+		t.Fatalf("a dashboard or admin failure was reported: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("Serve returned %v", err)
+	}
+}
+
+func TestServeShutsDownWhenTheHTTPProxyFails(t *testing.T) {
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+graph_listen: `+freeAddr(t)+`
+metrics_listen: `+freeAddr(t)+`
+http_proxy:
+  listen: `+occupy(t)+`
+  routes:
+    - path_prefix: /
+      service: cart
+services:
+  - name: cart
+    backends:
+      - name: cart-1
+        address: 127.0.0.1
+        port: 1
+`)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(context.Background(), grpc.NewServer(), lis) }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "HTTP proxy server") {
+			t.Fatalf("Serve returned %v, want the HTTP proxy's failure", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Serve kept running without its HTTP proxy")
+	}
+}
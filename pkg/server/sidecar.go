@@ -2,98 +2,195 @@ package server
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"strings"
+	"sort"
 	"sync"
-	"text/tabwriter"
+	"sync/atomic"
 	"time"
 
+	"try/pkg/balancer"
+	"try/pkg/circuit"
+	"try/pkg/config"
+	"try/pkg/discovery"
 	pb "try/pkg/grpcapi"
+	"try/pkg/metrics"
+	"try/pkg/tlsconfig"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
 type SidecarServer struct {
 	pb.UnimplementedSidecarServiceServer
-}
 
-type BackendMetrics struct {
-	CPUUsage       float64
-	MemoryUsage    float64
-	NetworkTraffic float64
-}
+	// snap is the configuration in effect and the services built from it,
+	// swapped as a whole by Reload. reloadMu serializes Reload and Close.
+	snap     atomic.Pointer[snapshot]
+	reloadMu sync.Mutex
 
-var (
-	backendHistory  = map[string][]BackendMetrics{"a": {}, "b": {}, "c": {}}
-	requestCounts   = map[string]int{"a": 0, "b": 0, "c": 0}
-	countLock       sync.Mutex
-	maxHistory      = 10
-	externalPortMap = map[string]string{
-		"user-service-a": "x",
-		"user-service-b": "y",
-		"user-service-c": "z",
-	}
-	publicIP      = "x.y.z.w"
-	prometheusURL = "http://x.y.z.w"
-	graphOnce     sync.Once
-)
+	watcher       *discovery.Watcher
+	metricsClient metricsclient.Interface
+	backendConns  connPool
+	registry      *prometheus.Registry
+	tracer        trace.Tracer
+	// tlsFiles are the gRPC listener's certificates, nil without TLS.
+	tlsFiles *tlsconfig.Files
+	// events feeds the /events stream.
+	events *eventHub
+	stop   chan struct{}
 
-func getBackendMetrics(backend string) BackendMetrics {
-	suffix := string(backend[len(backend)-1])
-	podRegex := fmt.Sprintf("user-service-%s.*", suffix)
+	// shuttingDown is closed when shutdown starts, failing readiness, and
+	// draining when the listeners close.
+	shuttingDown chan struct{}
+	draining     chan struct{}
+	drainOnce    sync.Once
+	// servers are the HTTP servers to shut down with the gRPC server, and
+	// serveErrs reports the first of them to fail.
+	serversMu sync.Mutex
+	servers   []*http.Server
+	serveErrs chan error
+}
 
-	cpu := queryPrometheusScalar(fmt.Sprintf(`rate(container_cpu_usage_seconds_total{pod=~"%s"}[5m])`, podRegex))
-	mem := queryPrometheusScalar(fmt.Sprintf(`container_memory_usage_bytes{pod=~"%s"}`, podRegex)) / (1024 * 1024)
-	netRx := queryPrometheusScalar(fmt.Sprintf(`rate(container_network_receive_bytes_total{pod=~"%s"}[5m])`, podRegex))
-	netTx := queryPrometheusScalar(fmt.Sprintf(`rate(container_network_transmit_bytes_total{pod=~"%s"}[5m])`, podRegex))
-	net := netRx + netTx
+type Option func(*SidecarServer)
 
-	cpuPercent := cpu * 100
-	memPercent := (mem / 33560.0) * 100
+// WithKubernetesClient enables EndpointSlice discovery for services that
+// declare a kubernetes section.
+func WithKubernetesClient(client kubernetes.Interface) Option {
+	return func(s *SidecarServer) {
+		s.watcher = discovery.NewWatcher(client, 10*time.Minute)
+	}
+}
 
-	return BackendMetrics{cpuPercent, memPercent, net}
+// WithMetricsClient enables the metrics.k8s.io source for services whose
+// metrics source is metrics-server.
+func WithMetricsClient(client metricsclient.Interface) Option {
+	return func(s *SidecarServer) {
+		s.metricsClient = client
+	}
 }
 
-func queryPrometheusScalar(query string) float64 {
-	url := fmt.Sprintf("%s/api/v1/query?query=%s", prometheusURL, query)
-	url = strings.ReplaceAll(url, " ", "")
-	resp, err := http.Get(url)
+// KubernetesOptions returns the options for the Kubernetes APIs cfg needs,
+// using kubeconfig or the in-cluster service account when it is empty.
+func KubernetesOptions(cfg *config.Config, kubeconfig string) ([]Option, error) {
+	if !cfg.UsesKubernetes() && !cfg.UsesMetricsServer() {
+		return nil, nil
+	}
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
-		log.Printf("Failed to query Prometheus: %v", err)
-		return 0
+		return nil, err
+	}
+
+	var opts []Option
+	if cfg.UsesKubernetes() {
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKubernetesClient(client))
 	}
-	defer resp.Body.Close()
+	if cfg.UsesMetricsServer() {
+		client, err := metricsclient.NewForConfig(restConfig)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMetricsClient(client))
+	}
+	return opts, nil
+}
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	var result struct {
-		Data struct {
-			Result []struct {
-				Value [2]interface{} `json:"value"`
-			} `json:"result"`
-		} `json:"data"`
+func NewSidecarServer(cfg *config.Config, opts ...Option) (*SidecarServer, error) {
+	s := &SidecarServer{
+		stop:         make(chan struct{}),
+		shuttingDown: make(chan struct{}),
+		draining:     make(chan struct{}),
+		serveErrs:    make(chan error, 1),
 	}
-	if err := json.Unmarshal(body, &result); err != nil || len(result.Data.Result) == 0 {
-		return 0
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.tracer == nil {
+		s.tracer = otel.Tracer(tracerName)
 	}
 
-	valueStr := result.Data.Result[0].Value[1].(string)
-	var value float64
-	fmt.Sscanf(valueStr, "%f", &value)
-	return value
+	if cfg.TLS.Enabled() {
+		files, err := tlsconfig.Load(cfg.TLS.CertFile, cfg.TLS.KeyFile, cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading TLS certificates: %w", err)
+		}
+		s.tlsFiles = files
+		go files.Watch(cfg.TLS.ReloadInterval, s.stop)
+	}
+
+	s.registry = newRegistry(s)
+	s.events = newEventHub()
+	snap, err := s.build(cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.syncDiscovery()
+	s.snap.Store(snap)
+	s.start(snap)
+	s.logRequestCount()
+	return s, nil
 }
 
-func updateHistory(backend string, metrics BackendMetrics) {
-	history := backendHistory[backend]
-	if len(history) >= maxHistory {
-		history = history[1:]
+// Close stops background discovery, metric refreshes and the open streams.
+func (s *SidecarServer) Close() {
+	s.drain()
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	close(s.stop)
+	close(s.snapshot().retired)
+	s.snapshot().stopChecks(nil)
+	if s.watcher != nil {
+		s.watcher.Stop()
 	}
-	backendHistory[backend] = append(history, metrics)
+	s.backendConns.close()
+}
+
+// score is a backend's combined load score, lower is better, and the
+// weighted terms Total is the sum of.
+type score struct {
+	Total   float64
+	CPU     float64
+	Memory  float64
+	Network float64
+	Errors  float64
+}
+
+// errorPenalty is the score added for a backend whose requests all fail,
+// twice what a fully busy CPU adds.
+const errorPenalty = 100
+
+func (sc score) scale(f float64) score {
+	return score{Total: sc.Total * f, CPU: sc.CPU * f, Memory: sc.Memory * f, Network: sc.Network * f, Errors: sc.Errors * f}
+}
+
+// withErrors adds the penalty for a failure rate between 0 and 1.
+func (sc score) withErrors(failureRate float64) score {
+	sc.Errors = errorPenalty * failureRate
+	sc.Total = sc.CPU + sc.Memory + sc.Network + sc.Errors
+	return sc
+}
+
+func (sc score) proto() *pb.Score {
+	return &pb.Score{Total: sc.Total, Cpu: sc.CPU, Memory: sc.Memory, Network: sc.Network, Errors: sc.Errors}
 }
 
-func combinedScore(current BackendMetrics, history []BackendMetrics) float64 {
+func combinedScore(current metrics.BackendMetrics, history []metrics.BackendMetrics) score {
 	var avgCPU, avgMem, avgNet float64
 	for _, m := range history {
 		avgCPU += m.CPUUsage
@@ -109,175 +206,257 @@ func combinedScore(current BackendMetrics, history []BackendMetrics) float64 {
 	blendedCPU := 0.7*avgCPU + 0.3*current.CPUUsage
 	blendedMem := 0.7*avgMem + 0.3*current.MemoryUsage
 	blendedNet := 0.7*avgNet + 0.3*current.NetworkTraffic
-	return 0.5*blendedCPU + 0.3*blendedMem + 0.2*blendedNet
+	sc := score{CPU: 0.5 * blendedCPU, Memory: 0.3 * blendedMem, Network: 0.2 * blendedNet}
+	sc.Total = sc.CPU + sc.Memory + sc.Network
+	return sc
 }
 
-func selectBestBackend(serviceName string) (string, string) {
-	backends := []string{"a", "b", "c"}
-	scores := map[string]float64{}
-
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Printf("\nPOD stats for %s\n", serviceName)
-	fmt.Fprintln(w, "BACKEND\tCPU (%)\tMEMORY (%)\tNETWORK (B/s)")
-
-	for _, suffix := range backends {
-		backend := serviceName + "-" + suffix
-		metrics := getBackendMetrics(backend)
-		updateHistory(suffix, metrics)
-		scores[suffix] = combinedScore(metrics, backendHistory[suffix])
-		fmt.Fprintf(w, "%s\t%.2f\t%.2f\t%.2f\n", backend, metrics.CPUUsage, metrics.MemoryUsage, metrics.NetworkTraffic)
-	}
-	w.Flush()
-	os.Stdout.Sync()
-	fmt.Println("--------------------")
-
-	best := backends[0]
-	for _, b := range backends[1:] {
-		if scores[b] < scores[best] {
-			best = b
+// candidate is a backend as it was when it was ranked; the backend itself
+// may change once svc.mu is released.
+type candidate struct {
+	discovery.Backend
+	metrics metrics.BackendMetrics
+	score   score
+	backend *backend
+	// trial is the circuit's half-open trial the request is, if any.
+	trial circuit.Trial
+}
+
+// chooseBackend picks a healthy backend with the service's balancer (or
+// strategy, if set) and ranks the other healthy ones by score as fallbacks.
+// Backends ejected by outlier detection or with an open circuit are skipped
+// like unhealthy ones. It only reads the metrics cache, never the metrics
+// source. The chosen backend counts as outstanding until release is called.
+func (s *SidecarServer) chooseBackend(ctx context.Context, svc *service, strategy string) (candidate, []candidate, error) {
+	spanStrategy := strategy
+	if spanStrategy == "" {
+		spanStrategy = svc.strategy
+	}
+	_, span := s.tracer.Start(ctx, "select backend", trace.WithAttributes(
+		attribute.String("sidecar.service", svc.name),
+		attribute.String("sidecar.strategy", spanStrategy),
+	))
+	defer span.End()
+
+	bal, err := svc.balancer(strategy)
+	if err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return candidate{}, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	var candidates []candidate
+	var picks []balancer.Candidate
+	skipped := 0
+	for _, b := range svc.current() {
+		if reason := svc.unavailable(b.Name); reason != "" {
+			slog.Debug("skipping backend", "service", svc.name, "backend", b.Name, "reason", reason)
+			skipped++
+			continue
 		}
+		c := candidate{Backend: b.Backend, metrics: b.metrics, score: svc.score(b), backend: b}
+		candidates = append(candidates, c)
+		picks = append(picks, balancer.Candidate{
+			Name:        b.Name,
+			Weight:      svc.weight(b),
+			Score:       c.score.Total,
+			Outstanding: b.outstanding,
+		})
 	}
 
-	selected := serviceName + "-" + best
-	fmt.Printf("Selected: %s with score %.2f\n", selected, scores[best])
-	return selected, best
+	if len(candidates) == 0 {
+		noBackendTotal.WithLabelValues(svc.name).Inc()
+		slog.Warn("no backend available", "service", svc.name, "skipped", skipped)
+		span.SetAttributes(attribute.Int("sidecar.skipped", skipped))
+		span.SetStatus(otelcodes.Error, "no backend available")
+		return candidate{}, nil, status.Errorf(codes.Unavailable, "no healthy backends available for service %q", svc.name)
+	}
+	i := bal.Pick(picks)
+	selected := candidates[i]
+	selectedScore.WithLabelValues(svc.name).Observe(selected.score.Total)
+	span.SetAttributes(
+		attribute.Int("sidecar.candidates", len(candidates)),
+		attribute.Int("sidecar.skipped", skipped),
+		attribute.String("sidecar.backend", selected.Name),
+		attribute.Float64("sidecar.score", selected.score.Total),
+	)
+	selected.backend.outstanding++
+	if svc.circuits != nil {
+		selected.trial = svc.circuits.Acquire(selected.Name)
+	}
+
+	fallbacks := append(append([]candidate(nil), candidates[:i]...), candidates[i+1:]...)
+	sort.SliceStable(fallbacks, func(i, j int) bool { return fallbacks[i].score.Total < fallbacks[j].score.Total })
+	return selected, fallbacks, nil
+}
+
+// acquire counts c as outstanding, for a backend tried after the chosen one,
+// and returns it to be passed to release.
+func (s *SidecarServer) acquire(svc *service, c candidate) candidate {
+	svc.mu.Lock()
+	c.backend.outstanding++
+	svc.mu.Unlock()
+	if svc.circuits != nil {
+		c.trial = svc.circuits.Acquire(c.Name)
+	}
+	return c
+}
+
+func (s *SidecarServer) release(svc *service, c candidate) {
+	svc.mu.Lock()
+	c.backend.outstanding--
+	svc.mu.Unlock()
+	if svc.circuits != nil {
+		svc.circuits.Done(c.Name, c.trial)
+	}
+}
+
+// countRequest records a request served by c for logRequestCount, the
+// dashboard and sidecar_requests_total.
+func (s *SidecarServer) countRequest(svc *service, c candidate, via string) {
+	svc.mu.Lock()
+	c.backend.requests++
+	c.backend.served++
+	c.backend.sampleRequests++
+	svc.mu.Unlock()
+	requestsTotal.WithLabelValues(svc.name, c.Name, via).Inc()
+}
+
+func newDecisionID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
 }
 
-func logRequestCount() {
+func (s *SidecarServer) logRequestCount() {
 	ticker := time.NewTicker(10 * time.Second)
 	go func() {
-		for range ticker.C {
-			countLock.Lock()
-			fmt.Println("--- Request Count in Last 10s ---")
-			for backend, count := range requestCounts {
-				fmt.Printf("%s: %d requests\n", backend, count)
-				requestCounts[backend] = 0
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+			services, _ := s.snapshot().selectServices("")
+			for _, svc := range services {
+				var counts []any
+				svc.mu.Lock()
+				for _, b := range svc.current() {
+					counts = append(counts, slog.Int(b.Name, b.requests))
+					b.requests = 0
+				}
+				svc.mu.Unlock()
+				slog.Info("requests in the last 10s", "service", svc.name, slog.Group("requests", counts...))
 			}
-			countLock.Unlock()
 		}
 	}()
 }
 
 func (s *SidecarServer) RouteRequest(ctx context.Context, req *pb.RouteRequestRequest) (*pb.RouteResponse, error) {
 	if req == nil || req.ServiceName == "" {
-		return nil, fmt.Errorf("invalid request: service name is empty")
+		return nil, status.Error(codes.InvalidArgument, "invalid request: service name is empty")
+	}
+	if err := s.authorize(ctx, req.ServiceName); err != nil {
+		return nil, err
+	}
+	svc, ok := s.snapshot().services[req.ServiceName]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.ServiceName)
 	}
 
-	startGraphServer() // start graph server only when the first request comes
-
-	selected, best := selectBestBackend(req.ServiceName)
-	port := externalPortMap[selected]
-	url := fmt.Sprintf("http://%s:%s", publicIP, port)
+	mode := req.Mode
+	if mode == "" {
+		mode = svc.mode
+	}
+	var call backendCall
+	switch mode {
+	case config.ModeDecisionOnly:
+	case config.ModeProbe:
+		call = func(ctx context.Context, c candidate) (*backendResult, error) {
+			return probeBackend(ctx, svc.probe, c)
+		}
+	case config.ModeProxy:
+		call = func(ctx context.Context, c candidate) (*backendResult, error) {
+			return proxyToBackend(ctx, svc.proxy, c, req)
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown mode %q", mode)
+	}
 
-	start := time.Now()
-	resp, err := http.Get(url)
-	elapsed := time.Since(start)
+	selected, fallbackCandidates, err := s.chooseBackend(ctx, svc, req.Strategy)
 	if err != nil {
-		return nil, fmt.Errorf("error calling backend %s: %v", url, err)
+		return nil, err
+	}
+	if call == nil {
+		// The caller sends the request itself, so the sidecar never sees it
+		// end; count the backend as busy with it for decisionHold.
+		time.AfterFunc(svc.decisionHold, func() { s.release(svc, selected) })
+	} else {
+		defer s.release(svc, selected)
 	}
-	defer resp.Body.Close()
+	d := newDecision(svc, viaRouteRequest, req.Strategy, selected, fallbackCandidates)
 
-	countLock.Lock()
-	requestCounts[best]++
-	countLock.Unlock()
+	served := selected
+	var result *backendResult
+	var attempts []*pb.Attempt
+	if call != nil {
+		served, result, attempts, err = s.callWithRetries(ctx, svc, selected, fallbackCandidates, call)
+		if err != nil {
+			s.logDecision(d, served, err, "mode", mode, "attempts", len(attempts))
+			return nil, attemptsError(err, served, attempts)
+		}
+	}
 
-	fmt.Printf("Response from %s: %s (took %v)\n\n", selected, resp.Status, elapsed)
-	return &pb.RouteResponse{Backend: url}, nil
-}
+	s.countRequest(svc, served, viaRouteRequest)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("sidecar.service", svc.name),
+		attribute.String("sidecar.backend", served.Name),
+		attribute.Float64("sidecar.score", served.score.Total),
+		attribute.String("sidecar.decision_id", d.id),
+	)
+	if result != nil {
+		s.logDecision(d, served, nil, "mode", mode, "attempts", len(attempts),
+			"status", result.statusCode, "backend_latency", result.latency)
+	} else {
+		s.logDecision(d, served, nil, "mode", mode)
+	}
 
-func serveLiveData() {
-	http.HandleFunc("/data", func(w http.ResponseWriter, r *http.Request) {
-		metrics := getBackendMetrics("user-service-a")
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"timestamp": time.Now().Format("15:04:05"),
-			"cpu":       metrics.CPUUsage,
-			"mem":       metrics.MemoryUsage,
-			"net":       metrics.NetworkTraffic,
+	tried := map[string]bool{}
+	for _, a := range attempts {
+		tried[a.BackendName] = true
+	}
+	var fallbacks []*pb.RankedBackend
+	for _, c := range append([]candidate{selected}, fallbackCandidates...) {
+		if c.Name == served.Name || tried[c.Name] {
+			continue
+		}
+		fallbacks = append(fallbacks, &pb.RankedBackend{
+			Name:  c.Name,
+			Host:  c.Address,
+			Port:  int32(c.Port),
+			Url:   c.URL(),
+			Score: c.score.proto(),
 		})
-	})
-}
-
-func serveGraphPage() {
-	http.HandleFunc("/graph", func(w http.ResponseWriter, r *http.Request) {
-		html := `<!DOCTYPE html>
-<html lang="en">
-<head>
-<meta charset="UTF-8">
-<title>Live Metrics Dashboard</title>
-<script src="https://cdn.jsdelivr.net/npm/chart.js"></script>
-<style>
-body { margin: 0; background-color: #111; color: white; font-family: 'Segoe UI', sans-serif; }
-h2 { text-align: center; margin: 20px 0; font-size: 32px; }
-#chart-container { width: 100vw; height: 90vh; padding: 0 30px; box-sizing: border-box; }
-canvas { width: 100% !important; height: 100% !important; }
-</style>
-</head>
-<body>
-<h2>Live CPU, Memory, and Network Usage</h2>
-<div id="chart-container"><canvas id="chart"></canvas></div>
-<script>
-const ctx = document.getElementById('chart').getContext('2d');
-const chart = new Chart(ctx, {
-	type: 'line',
-	data: {
-		labels: [],
-		datasets: [
-			{ label: 'CPU %', data: [], borderColor: 'red', fill: false, tension: 0.3 },
-			{ label: 'Memory %', data: [], borderColor: 'blue', fill: false, tension: 0.3 },
-			{ label: 'Network B/s', data: [], borderColor: 'green', fill: false, tension: 0.3 }
-		]
-	},
-	options: {
-		responsive: true,
-		maintainAspectRatio: false,
-		scales: {
-			y: {
-				beginAtZero: true,
-				title: { display: true, text: 'Usage', color: 'white' },
-				ticks: { color: 'white' }
-			},
-			x: {
-				title: { display: true, text: 'Time', color: 'white' },
-				ticks: { color: 'white' }
-			}
-		},
-		plugins: { legend: { labels: { color: 'white' } } }
-	}
-});
-setInterval(() => {
-	fetch('/data')
-		.then(res => res.json())
-		.then(data => {
-			chart.data.labels.push(data.timestamp);
-			chart.data.datasets[0].data.push(data.cpu);
-			chart.data.datasets[1].data.push(data.mem);
-			chart.data.datasets[2].data.push(data.net);
-			if (chart.data.labels.length > 30) {
-				chart.data.labels.shift();
-				chart.data.datasets.forEach(ds => ds.data.shift());
-			}
-			chart.update();
-		});
-}, 2000);
-</script>
-</body>
-</html>`
-		w.Write([]byte(html))
-	})
-}
-
-func startGraphServer() {
-	graphOnce.Do(func() {
-		serveLiveData()
-		serveGraphPage()
-		go func() {
-			log.Println("Starting live graph server on :8081")
-			log.Fatal(http.ListenAndServe(":8081", nil))
-		}()
-	})
-}
-
-func init() {
-	logRequestCount()
+	}
+	resp := &pb.RouteResponse{
+		Backend:     served.URL(),
+		BackendName: served.Name,
+		Host:        served.Address,
+		Port:        int32(served.Port),
+		Score:       served.score.proto(),
+		Fallbacks:   fallbacks,
+		DecisionId:  d.id,
+		Mode:        mode,
+		Attempts:    attempts,
+	}
+	if result != nil {
+		resp.StatusCode = int32(result.statusCode)
+		resp.Latency = durationpb.New(result.latency)
+		resp.Body = result.body
+		resp.Headers = result.headers()
+	}
+	return resp, nil
 }
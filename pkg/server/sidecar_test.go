@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"try/pkg/config"
+	pb "try/pkg/grpcapi"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// fakePrometheus answers every query with an empty result.
+func fakePrometheus(t *testing.T) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"status": "success",
+			"data":   map[string]any{"resultType": "vector", "result": []any{}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// backendAddr returns the host and port of a test server.
+func backendAddr(t *testing.T, srv *httptest.Server) (string, string) {
+	t.Helper()
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host, port
+}
+
+// newTestServer starts a sidecar for the configuration in yaml, which may
+// use %[1]s for the URL of a Prometheus without data.
+func newTestServer(t *testing.T, yaml string, opts ...Option) *SidecarServer {
+	t.Helper()
+	cfg, err := config.Parse([]byte(fmt.Sprintf(yaml, fakePrometheus(t))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSidecarServer(cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// dial serves s's gRPC API on a loopback port and returns a client for it.
+func dial(t *testing.T, s *SidecarServer) pb.SidecarServiceClient {
+	t.Helper()
+	return pb.NewSidecarServiceClient(dialConn(t, s))
+}
+
+// dialConn serves s's gRPC listener on a loopback port and returns a
+// connection to it.
+func dialConn(t *testing.T, s *SidecarServer) *grpc.ClientConn {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grpcServer := grpc.NewServer(s.GRPCServerOptions()...)
+	pb.RegisterSidecarServiceServer(grpcServer, s)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestDecisionOnlyPicksCountAsOutstanding(t *testing.T) {
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+services:
+  - name: cart
+    balancer: least-outstanding
+    decision_hold: 200ms
+    backends:
+      - name: cart-1
+        address: 127.0.0.1
+        port: 1
+      - name: cart-2
+        address: 127.0.0.1
+        port: 2
+`)
+	client := dial(t, s)
+	picked := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		resp, err := client.RouteRequest(context.Background(), &pb.RouteRequestRequest{ServiceName: "cart"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked[resp.BackendName] = true
+	}
+	if len(picked) != 2 {
+		t.Errorf("two decisions in a row picked %v, want both backends", picked)
+	}
+
+	svc := s.snapshot().services["cart"]
+	outstanding := func() int {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		n := 0
+		for _, b := range svc.backends {
+			n += b.outstanding
+		}
+		return n
+	}
+	if got := outstanding(); got != 2 {
+		t.Errorf("%d requests outstanding during decision_hold, want 2", got)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for outstanding() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("decision-only picks never released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
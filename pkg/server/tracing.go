@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"try/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tracerName is the instrumentation scope of the sidecar's spans.
+const tracerName = "try/pkg/server"
+
+// WithTracerProvider records spans with tp instead of the global tracer
+// provider, e.g. one from tracingtest.NewInMemory in tests.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *SidecarServer) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// traceUnary starts a server span for each unary call, continuing the
+// caller's trace if its metadata carries one.
+func (s *SidecarServer) traceUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, span := s.startRPCSpan(ctx, info.FullMethod)
+	defer span.End()
+	resp, err := handler(ctx, req)
+	endRPCSpan(span, err)
+	return resp, err
+}
+
+// traceStream is traceUnary for streaming calls, proxied ones included.
+func (s *SidecarServer) traceStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, span := s.startRPCSpan(ss.Context(), info.FullMethod)
+	defer span.End()
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	endRPCSpan(span, err)
+	return err
+}
+
+// contextStream is a server stream whose context an interceptor replaced.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *SidecarServer) startRPCSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = tracing.Propagator.Extract(ctx, tracing.MetadataCarrier(md))
+	name := strings.TrimPrefix(fullMethod, "/")
+	service, method, _ := strings.Cut(name, "/")
+	return s.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+	))
+}
+
+func endRPCSpan(span trace.Span, err error) {
+	code := status.Code(err)
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if err != nil {
+		span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+	}
+}
+
+// startBackendSpan starts a client span for one call to a backend.
+func (s *SidecarServer) startBackendSpan(ctx context.Context, svc *service, c candidate, attempt int) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "backend call", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("sidecar.service", svc.name),
+		attribute.String("sidecar.backend", c.Name),
+		attribute.Float64("sidecar.score", c.score.Total),
+		attribute.String("server.address", c.Address),
+		attribute.Int("server.port", c.Port),
+		attribute.Int("sidecar.attempt", attempt),
+	))
+}
+
+// endBackendSpan records the outcome of a backend call and ends its span.
+// statusCode is the HTTP status, or 0 if there was none.
+func endBackendSpan(span trace.Span, statusCode int, err error) {
+	if statusCode != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	}
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	case statusCode >= 500:
+		span.SetStatus(otelcodes.Error, "")
+	}
+	span.End()
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pb "try/pkg/grpcapi"
+	"try/pkg/tracing/tracingtest"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("no %q span among %d", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func checkAttributes(t *testing.T, span tracetest.SpanStub, want ...attribute.KeyValue) {
+	t.Helper()
+	got := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		got[kv.Key] = kv.Value
+	}
+	for _, kv := range want {
+		if v, ok := got[kv.Key]; !ok || v != kv.Value {
+			t.Errorf("%s: %s = %v, want %v", span.Name, kv.Key, v.Emit(), kv.Value.Emit())
+		}
+	}
+}
+
+func TestRouteRequestTrace(t *testing.T) {
+	traceparents := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+	}))
+	defer backend.Close()
+	host, port := backendAddr(t, backend)
+
+	tp, exporter := tracingtest.NewInMemory()
+	s := newTestServer(t, `
+prometheus_url: %[1]s
+services:
+  - name: cart
+    mode: probe
+    probe:
+      path: /ping
+    backends:
+      - name: cart-1
+        address: `+host+`
+        port: `+port+`
+`, WithTracerProvider(tp))
+	client := dial(t, s)
+
+	// The caller's trace, which the sidecar's spans must continue.
+	const callerTraceID, callerSpanID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"traceparent", "00-"+callerTraceID+"-"+callerSpanID+"-01")
+	resp, err := client.RouteRequest(ctx, &pb.RouteRequestRequest{ServiceName: "cart"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	rpc := spanNamed(t, spans, "grpcapi.SidecarService/RouteRequest")
+	selection := spanNamed(t, spans, "select backend")
+	call := spanNamed(t, spans, "backend call")
+
+	if got := rpc.SpanContext.TraceID().String(); got != callerTraceID {
+		t.Errorf("trace ID = %s, want the caller's %s", got, callerTraceID)
+	}
+	if got := rpc.Parent.SpanID().String(); got != callerSpanID || !rpc.Parent.IsRemote() {
+		t.Errorf("RouteRequest span's parent = %s, want the caller's span %s", got, callerSpanID)
+	}
+	for _, child := range []tracetest.SpanStub{selection, call} {
+		if child.Parent.SpanID() != rpc.SpanContext.SpanID() {
+			t.Errorf("%s span is not a child of the RouteRequest span", child.Name)
+		}
+		if child.SpanContext.TraceID() != rpc.SpanContext.TraceID() {
+			t.Errorf("%s span is in another trace", child.Name)
+		}
+	}
+	if call.StartTime.Before(selection.EndTime) {
+		t.Error("backend call started before the backend was selected")
+	}
+
+	if rpc.SpanKind != trace.SpanKindServer {
+		t.Errorf("RouteRequest span kind = %v, want server", rpc.SpanKind)
+	}
+	checkAttributes(t, rpc,
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", "grpcapi.SidecarService"),
+		attribute.String("rpc.method", "RouteRequest"),
+		attribute.Int("rpc.grpc.status_code", 0),
+		attribute.String("sidecar.service", "cart"),
+		attribute.String("sidecar.backend", "cart-1"),
+		attribute.String("sidecar.decision_id", resp.DecisionId),
+	)
+	checkAttributes(t, selection,
+		attribute.String("sidecar.service", "cart"),
+		attribute.String("sidecar.strategy", "metric-score"),
+		attribute.Int("sidecar.candidates", 1),
+		attribute.Int("sidecar.skipped", 0),
+		attribute.String("sidecar.backend", "cart-1"),
+	)
+	if call.SpanKind != trace.SpanKindClient {
+		t.Errorf("backend call span kind = %v, want client", call.SpanKind)
+	}
+	checkAttributes(t, call,
+		attribute.String("sidecar.service", "cart"),
+		attribute.String("sidecar.backend", "cart-1"),
+		attribute.String("server.address", host),
+		attribute.Int("sidecar.attempt", 1),
+		attribute.Int("http.response.status_code", http.StatusOK),
+	)
+
+	// The backend's request carries the backend call span as its parent.
+	carrier := propagation.HeaderCarrier{"Traceparent": {<-traceparents}}
+	got := trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	if got.TraceID() != call.SpanContext.TraceID() || got.SpanID() != call.SpanContext.SpanID() {
+		t.Errorf("backend got traceparent %q, want trace %s span %s", carrier.Get("traceparent"),
+			call.SpanContext.TraceID(), call.SpanContext.SpanID())
+	}
+}
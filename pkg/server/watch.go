@@ -0,0 +1,77 @@
+package server
+
+import (
+	pb "try/pkg/grpcapi"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func (s *SidecarServer) WatchBackends(req *pb.WatchBackendsRequest, stream grpc.ServerStreamingServer[pb.BackendsUpdate]) error {
+	if req == nil || req.ServiceName == "" {
+		return status.Error(codes.InvalidArgument, "invalid request: service name is empty")
+	}
+	if err := s.authorize(stream.Context(), req.ServiceName); err != nil {
+		return err
+	}
+	svc, ok := s.snapshot().services[req.ServiceName]
+	if !ok {
+		return status.Errorf(codes.NotFound, "unknown service %q", req.ServiceName)
+	}
+
+	var last *pb.BackendsUpdate
+	for {
+		// Take the channels before the snapshot so that a change made while
+		// building it is not missed.
+		metricsChanged, backendsChanged := svc.watch()
+		update := backendsUpdate(svc)
+		if !proto.Equal(update, last) {
+			if err := stream.Send(update); err != nil {
+				return err
+			}
+			last = update
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.draining:
+			return status.Error(codes.Unavailable, "sidecar is shutting down")
+		case <-metricsChanged:
+		case <-backendsChanged:
+		case <-svc.retired:
+			// A reload replaced the service; follow its successor.
+			if svc, ok = s.snapshot().services[req.ServiceName]; !ok {
+				return status.Errorf(codes.NotFound, "service %q was removed from the configuration", req.ServiceName)
+			}
+		}
+	}
+}
+
+func backendsUpdate(svc *service) *pb.BackendsUpdate {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	update := &pb.BackendsUpdate{ServiceName: svc.name}
+	for _, b := range svc.current() {
+		update.Backends = append(update.Backends, &pb.BackendStatus{
+			Name:   b.Name,
+			Host:   b.Address,
+			Port:   int32(b.Port),
+			Url:    b.URL(),
+			Weight: int32(svc.weight(b)),
+			Metrics: &pb.BackendMetrics{
+				CpuUsage:       b.metrics.CPUUsage,
+				MemoryUsage:    b.metrics.MemoryUsage,
+				NetworkTraffic: b.metrics.NetworkTraffic,
+			},
+			Score:   svc.score(b).Total,
+			Healthy: svc.healthStatus(b.Name).Healthy,
+			Ejected: svc.ejected(b.Name),
+			Circuit: svc.circuitState(b.Name),
+		})
+	}
+	return update
+}
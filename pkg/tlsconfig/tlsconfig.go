@@ -0,0 +1,165 @@
+// Package tlsconfig builds TLS configurations from certificates on disk and
+// reloads them when the files change, so that certificates can be rotated
+// without a restart.
+package tlsconfig
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Files is a certificate and key pair and an optional CA bundle read from
+// disk. Configurations built from it use the files' latest contents.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	mu   sync.RWMutex
+	sum  []byte
+	cert *tls.Certificate
+	cas  *x509.CertPool
+}
+
+// Load reads the files. Any of them may be empty: a client without a
+// certificate, or a server that does not verify clients.
+func Load(certFile, keyFile, caFile string) (*Files, error) {
+	f := &Files{CertFile: certFile, KeyFile: keyFile, CAFile: caFile}
+	if _, err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload rereads the files and reports whether they changed. If they can't
+// be read or parsed, the previous certificate and CAs stay in use.
+func (f *Files) Reload() (bool, error) {
+	h := sha256.New()
+	var certPEM, keyPEM, caPEM []byte
+	for _, file := range []struct {
+		name string
+		data *[]byte
+	}{{f.CertFile, &certPEM}, {f.KeyFile, &keyPEM}, {f.CAFile, &caPEM}} {
+		if file.name == "" {
+			continue
+		}
+		data, err := os.ReadFile(file.name)
+		if err != nil {
+			return false, err
+		}
+		*file.data = data
+		h.Write(data)
+	}
+	sum := h.Sum(nil)
+	f.mu.RLock()
+	unchanged := bytes.Equal(sum, f.sum)
+	f.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+	if f.CertFile != "" {
+		c, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return false, fmt.Errorf("loading %s: %w", f.CertFile, err)
+		}
+		if c.Leaf, err = x509.ParseCertificate(c.Certificate[0]); err != nil {
+			return false, fmt.Errorf("parsing %s: %w", f.CertFile, err)
+		}
+		cert = &c
+	}
+	var cas *x509.CertPool
+	if f.CAFile != "" {
+		cas = x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(caPEM) {
+			return false, fmt.Errorf("no certificates in %s", f.CAFile)
+		}
+	}
+
+	f.mu.Lock()
+	f.sum, f.cert, f.cas = sum, cert, cas
+	f.mu.Unlock()
+	return true, nil
+}
+
+// Watch reloads the files every interval until stop is closed.
+func (f *Files) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		changed, err := f.Reload()
+		if err != nil {
+			slog.Error("failed to reload TLS certificates, keeping the current ones", "cert", f.CertFile, "ca", f.CAFile, "error", err)
+			continue
+		}
+		if changed {
+			attrs := []any{"cert", f.CertFile, "ca", f.CAFile}
+			if cert := f.certificate(); cert != nil {
+				attrs = append(attrs, "not_after", cert.Leaf.NotAfter)
+			}
+			slog.Info("reloaded TLS certificates", attrs...)
+		}
+	}
+}
+
+func (f *Files) certificate() *tls.Certificate {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cert
+}
+
+func (f *Files) certPool() *x509.CertPool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.cas
+}
+
+// ServerConfig returns a server configuration presenting f's certificate
+// and, unless clientAuth is tls.NoClientCert, verifying client certificates
+// against f's CAs. Each handshake uses the latest files.
+func ServerConfig(f *Files, clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*f.certificate()},
+				ClientAuth:   clientAuth,
+				ClientCAs:    f.certPool(),
+				NextProtos:   []string{"h2"},
+			}, nil
+		},
+	}
+}
+
+// ClientConfig returns a client configuration verifying the server against
+// f's CAs, or the system roots if f has none, and presenting f's
+// certificate, if any, as the client certificate. The certificate is the
+// latest one at each handshake; the CAs are those loaded at the time of the
+// call.
+func ClientConfig(f *Files, serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		RootCAs:    f.certPool(),
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := f.certificate(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+}
@@ -0,0 +1,283 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var serial int64
+
+func newCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf named name, valid as
+// both a server certificate for localhost and a client certificate.
+func (ca *testCA) issue(t *testing.T, name string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func write(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// files writes a certificate, key and CA bundle to dir under prefix and
+// loads them.
+func files(t *testing.T, dir, prefix string, certPEM, keyPEM, caPEM []byte) *Files {
+	t.Helper()
+	var certFile, keyFile, caFile string
+	if certPEM != nil {
+		certFile, keyFile = filepath.Join(dir, prefix+".crt"), filepath.Join(dir, prefix+".key")
+		write(t, certFile, certPEM)
+		write(t, keyFile, keyPEM)
+	}
+	if caPEM != nil {
+		caFile = filepath.Join(dir, prefix+"-ca.crt")
+		write(t, caFile, caPEM)
+	}
+	f, err := Load(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// handshake runs a TLS handshake between server and client over loopback
+// and returns the connection state the client saw, and the client's and the
+// server's errors.
+func handshake(t *testing.T, server, client *tls.Config) (tls.ConnectionState, error, error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	serverErr := make(chan error, 1)
+	go func() {
+		c, err := lis.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer c.Close()
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+		conn := tls.Server(c, server)
+		if err = conn.Handshake(); err == nil {
+			// Wait for the client's byte: with TLS 1.3 the client only
+			// learns that its certificate was rejected after its
+			// handshake.
+			_, err = conn.Read(make([]byte, 1))
+		}
+		serverErr <- err
+	}()
+
+	c, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	conn := tls.Client(c, client)
+	clientErr := conn.Handshake()
+	if clientErr == nil {
+		_, clientErr = conn.Write([]byte{0})
+	}
+	return conn.ConnectionState(), clientErr, <-serverErr
+}
+
+func commonName(state tls.ConnectionState) string {
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return state.PeerCertificates[0].Subject.CommonName
+}
+
+func TestHandshake(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	serverCert, serverKey := ca.issue(t, "server")
+	server := files(t, dir, "server", serverCert, serverKey, nil)
+	client := files(t, dir, "client", nil, nil, ca.pem)
+
+	state, clientErr, serverErr := handshake(t, ServerConfig(server, tls.NoClientCert), ClientConfig(client, "localhost"))
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if got := commonName(state); got != "server" {
+		t.Errorf("server certificate = %q, want server", got)
+	}
+	if state.NegotiatedProtocol != "" && state.NegotiatedProtocol != "h2" {
+		t.Errorf("negotiated %q", state.NegotiatedProtocol)
+	}
+
+	// The client must verify the server against its CAs.
+	other := files(t, dir, "other", nil, nil, newCA(t, "other").pem)
+	if _, clientErr, _ := handshake(t, ServerConfig(server, tls.NoClientCert), ClientConfig(other, "localhost")); clientErr == nil {
+		t.Error("client accepted a server certificate of an unknown CA")
+	}
+	if _, clientErr, _ := handshake(t, ServerConfig(server, tls.NoClientCert), ClientConfig(client, "sidecar.example")); clientErr == nil {
+		t.Error("client accepted a server certificate for another name")
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	serverCert, serverKey := ca.issue(t, "server")
+	server := files(t, dir, "server", serverCert, serverKey, ca.pem)
+	serverConfig := ServerConfig(server, tls.RequireAndVerifyClientCert)
+
+	clientCert, clientKey := ca.issue(t, "client")
+	client := files(t, dir, "client", clientCert, clientKey, ca.pem)
+	if _, clientErr, serverErr := handshake(t, serverConfig, ClientConfig(client, "localhost")); clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+
+	anonymous := files(t, dir, "anonymous", nil, nil, ca.pem)
+	if _, _, serverErr := handshake(t, serverConfig, ClientConfig(anonymous, "localhost")); serverErr == nil {
+		t.Error("server accepted a client without a certificate")
+	}
+
+	otherCert, otherKey := newCA(t, "other").issue(t, "intruder")
+	intruder := files(t, dir, "intruder", otherCert, otherKey, ca.pem)
+	if _, _, serverErr := handshake(t, serverConfig, ClientConfig(intruder, "localhost")); serverErr == nil {
+		t.Error("server accepted a client certificate of an unknown CA")
+	}
+
+	// With optional client auth, clients without a certificate get in but
+	// certificates are still verified.
+	optional := ServerConfig(server, tls.VerifyClientCertIfGiven)
+	if _, clientErr, serverErr := handshake(t, optional, ClientConfig(anonymous, "localhost")); clientErr != nil || serverErr != nil {
+		t.Errorf("optional client auth refused a client without a certificate: client %v, server %v", clientErr, serverErr)
+	}
+	if _, _, serverErr := handshake(t, optional, ClientConfig(intruder, "localhost")); serverErr == nil {
+		t.Error("optional client auth accepted a client certificate of an unknown CA")
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	certPEM, keyPEM := ca.issue(t, "server-1")
+	server := files(t, dir, "server", certPEM, keyPEM, nil)
+	client := files(t, dir, "client", nil, nil, ca.pem)
+	serverConfig := ServerConfig(server, tls.NoClientCert)
+	clientConfig := ClientConfig(client, "localhost")
+
+	if changed, err := server.Reload(); changed || err != nil {
+		t.Fatalf("Reload of unchanged files = %v, %v; want false, nil", changed, err)
+	}
+
+	// Rotate the certificate; the same configurations serve the new one.
+	certPEM, keyPEM = ca.issue(t, "server-2")
+	write(t, server.CertFile, certPEM)
+	write(t, server.KeyFile, keyPEM)
+	if changed, err := server.Reload(); !changed || err != nil {
+		t.Fatalf("Reload of rotated files = %v, %v; want true, nil", changed, err)
+	}
+	state, clientErr, serverErr := handshake(t, serverConfig, clientConfig)
+	if clientErr != nil || serverErr != nil {
+		t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+	}
+	if got := commonName(state); got != "server-2" {
+		t.Errorf("server certificate = %q after rotation, want server-2", got)
+	}
+
+	// A half-written rotation, the key not matching the certificate, keeps
+	// the current certificate.
+	certPEM, _ = ca.issue(t, "server-3")
+	write(t, server.CertFile, certPEM)
+	if _, err := server.Reload(); err == nil {
+		t.Fatal("Reload accepted a certificate that does not match its key")
+	}
+	state, _, _ = handshake(t, serverConfig, clientConfig)
+	if got := commonName(state); got != "server-2" {
+		t.Errorf("server certificate = %q after a failed reload, want server-2", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t, "ca")
+	certPEM, keyPEM := ca.issue(t, "server-1")
+	server := files(t, dir, "server", certPEM, keyPEM, nil)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go server.Watch(10*time.Millisecond, stop)
+
+	certPEM, keyPEM = ca.issue(t, "server-2")
+	write(t, server.KeyFile, keyPEM)
+	write(t, server.CertFile, certPEM)
+	deadline := time.Now().Add(5 * time.Second)
+	for server.certificate().Leaf.Subject.CommonName != "server-2" {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not pick up the rotated certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}